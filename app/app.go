@@ -0,0 +1,217 @@
+// Package app собирает сервис из слоёв хранилище -> сервисы -> HTTP-обработчики поверх переданного подключения
+// к базе. Сервер строит его из настроек, а интеграционные тесты — поверх своей базы, не повторяя main.
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/cache"
+	"laba8/config"
+	"laba8/events"
+	"laba8/grpcapi"
+	"laba8/handler"
+	"laba8/mailer"
+	"laba8/metrics"
+	"laba8/ratelimit"
+	"laba8/repository"
+	"laba8/service"
+	"laba8/storage"
+)
+
+// Options структура необязательных зависимостей; пустые поля заполняются по настройкам
+type Options struct {
+	// Build сведения о сборке для /version
+	Build handler.BuildInfo
+	// Mailer отправка писем, nil — SMTP по SMTP_HOST или запись в лог
+	Mailer mailer.Mailer
+	// Files хранилище аватаров, nil — локальный диск в STORAGE_DIR
+	Files storage.Storage
+}
+
+// App структура собранного сервиса: HTTP-обработчик, сервисы для gRPC и фоновые обработчики
+type App struct {
+	// Handler маршруты HTTP API со всеми middleware
+	Handler http.Handler
+
+	Users        *service.UserService
+	Verification *service.VerificationService
+	Auth         *service.AuthService
+
+	jobs     *service.JobRunner
+	webhooks *service.WebhookService
+	outbox   *service.OutboxDispatcher
+	closers  []io.Closer
+}
+
+// New функция для сборки сервиса поверх подключения db; схема базы должна быть уже актуальной.
+// db не закрывается в Close — им владеет вызывающий
+func New(cfg *config.Config, db *pg.DB, opts Options) (*App, error) {
+	a := &App{}
+	validate := service.NewValidator()
+
+	files := opts.Files
+	if files == nil {
+		local, err := storage.NewLocal(cfg.StorageDir)
+		if err != nil {
+			return nil, fmt.Errorf("open file storage: %w", err)
+		}
+		files = local
+	}
+	userRepo := repository.NewUserRepository(db, repository.UserOptions{
+		CostCeiling:     cfg.QueryCostCeiling,
+		SkipNoopUpdates: cfg.SkipNoopUpdates,
+	})
+	if cfg.CacheTTLSeconds > 0 {
+		userCache, err := openCache(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("open cache: %w", err)
+		}
+		if closer, ok := userCache.(io.Closer); ok {
+			a.closers = append(a.closers, closer)
+		}
+		userRepo = repository.NewCachedUserRepository(userRepo, userCache, seconds(cfg.CacheTTLSeconds))
+	}
+	profileRepo := repository.NewProfileRepository(db)
+	a.Users = service.NewUserService(userRepo, repository.NewAuditRepository(db), validate,
+		service.UserOptions{MaxSortFields: cfg.MaxSortFields})
+	profiles := service.NewProfileService(profileRepo, validate)
+	avatars := service.NewAvatarService(userRepo, profileRepo, files, cfg.AvatarThumbSize)
+	mail := opts.Mailer
+	if mail == nil {
+		mail = newMailer(cfg.SMTP)
+	}
+	a.jobs = service.NewJobRunner(repository.NewJobRepository(db), service.JobOptions{
+		Workers:     cfg.JobWorkers,
+		MaxAttempts: cfg.JobMaxAttempts,
+		BaseBackoff: seconds(cfg.JobBackoffSeconds),
+		Timeout:     seconds(cfg.JobTimeoutSeconds),
+	})
+	a.Verification = service.NewVerificationService(userRepo, mail, a.jobs, cfg.JWTSecret,
+		time.Duration(cfg.VerifyTTLHours)*time.Hour, cfg.PublicURL)
+	accountRepo := repository.NewAccountRepository(db)
+	passwords := service.NewPasswordResetService(accountRepo, repository.NewResetTokenRepository(db), mail, a.jobs, validate,
+		time.Duration(cfg.ResetTTLMinutes)*time.Minute)
+	a.Auth = service.NewAuthService(
+		accountRepo,
+		repository.NewLoginAuditRepository(db),
+		repository.NewTokenRepository(db),
+		repository.NewInviteRepository(db),
+		validate,
+		cfg.JWTSecret,
+		time.Duration(cfg.JWTTTLMinutes)*time.Minute,
+		time.Duration(cfg.RefreshTTLHours)*time.Hour,
+		time.Duration(cfg.InviteTTLHours)*time.Hour,
+	)
+	tenants := service.NewTenantService(repository.NewTenantRepository(db), validate)
+	hub := events.NewHub(cfg.EventsHistory)
+	a.webhooks = service.NewWebhookService(repository.NewWebhookRepository(db), validate, service.WebhookOptions{
+		Timeout:     seconds(cfg.WebhookTimeoutSeconds),
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BaseBackoff: seconds(cfg.WebhookBackoffSeconds),
+	})
+	// События об изменениях пишутся в outbox в транзакции изменения; диспетчер ставит их в очередь webhook
+	// и рассылает в поток /events. Неопубликованное остаётся в outbox до следующего запуска
+	a.outbox = service.NewOutboxDispatcher(repository.NewOutboxRepository(db), a.webhooks.Enqueue, service.PublishTo(hub))
+
+	m := metrics.New()
+	m.RegisterDBPool(db)
+	var limiter ratelimit.Limiter
+	if cfg.RateLimitRPS > 0 {
+		limiter = ratelimit.NewMemory(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+	a.Handler = handler.New(cfg, handler.Deps{
+		Users:        a.Users,
+		Profiles:     profiles,
+		Avatars:      avatars,
+		Verification: a.Verification,
+		Passwords:    passwords,
+		Webhooks:     a.webhooks,
+		Jobs:         a.jobs,
+		Tenants:      tenants,
+		Auth:         a.Auth,
+		DB:           db,
+		Build:        opts.Build,
+		Metrics:      m,
+		Limiter:      limiter,
+		Events:       hub,
+	}).Routes()
+	return a, nil
+}
+
+// GRPCDeps функция для получения зависимостей gRPC-сервера поверх тех же сервисов, что и HTTP
+func (a *App) GRPCDeps(cfg *config.Config) grpcapi.Deps {
+	return grpcapi.Deps{
+		Users:          a.Users,
+		Verification:   a.Verification,
+		Auth:           a.Auth,
+		RequestTimeout: seconds(cfg.RequestTimeoutSeconds),
+		RetryTransient: cfg.RetryAfterSeconds > 0,
+	}
+}
+
+// Run функция для работы фоновых обработчиков (outbox, задачи, доставка webhook) до отмены ctx.
+// Возвращается, когда все они остановились; прерванное остаётся в очередях в базе
+func (a *App) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context){a.outbox.Run, a.jobs.Run, a.webhooks.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Close функция для освобождения ресурсов сервиса, кроме подключения к базе
+func (a *App) Close() error {
+	var firstErr error
+	for _, c := range a.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// newMailer функция для выбора отправки писем: SMTP, если задан SMTP_HOST, иначе запись в лог
+func newMailer(cfg config.SMTPConfig) mailer.Mailer {
+	if cfg.Host == "" {
+		slog.Warn("SMTP_HOST is not set, emails are written to the log")
+		return mailer.Log{}
+	}
+	return mailer.NewSMTP(mailer.SMTPConfig{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+	})
+}
+
+// openCache функция для создания кэша чтения: Redis, если задан REDIS_URL, иначе LRU в памяти процесса
+func openCache(cfg *config.Config) (cache.Cache, error) {
+	if cfg.RedisURL == "" {
+		return cache.NewMemory(cfg.CacheSize), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(cfg.ReadyTimeoutSeconds))
+	defer cancel()
+	redis, err := cache.NewRedis(ctx, cfg.RedisURL, "laba8:")
+	if err != nil {
+		return nil, err
+	}
+	return redis, nil
+}
+
+// seconds функция для перевода числа секунд из настроек в time.Duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,105 @@
+// Package cache содержит кэш значений по строковым ключам: LRU в памяти процесса или Redis для нескольких экземпляров.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache интерфейс кэша. Значения хранятся как байты, кодирование — забота вызывающего.
+// Ошибка означает недоступность кэша и не должна ломать запрос: вызывающий идёт в источник данных
+type Cache interface {
+	// Get возвращает значение ключа; ok=false — ключа нет или срок его жизни истёк
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set сохраняет значение на время ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete удаляет ключи; отсутствие ключа ошибкой не считается
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// entry структура для хранения значения в списке LRU
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// Memory реализация Cache в памяти процесса: не больше size ключей, при переполнении
+// вытесняется давно не читанный. Кэш не разделяется между экземплярами сервиса
+type Memory struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+// NewMemory функция для создания кэша в памяти на size ключей
+func NewMemory(size int) *Memory {
+	if size < 1 {
+		size = 1
+	}
+	return &Memory{
+		size:  size,
+		order: list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Get функция для чтения значения; прочитанный ключ становится самым свежим
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Set функция для сохранения значения с вытеснением самого старого ключа при переполнении
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := m.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expiresAt = value, expiresAt
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.items[key] = m.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Delete функция для удаления ключей
+func (m *Memory) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := m.items[key]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+// remove функция для удаления элемента из списка и индекса; вызывается под мьютексом
+func (m *Memory) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.items, el.Value.(*entry).key)
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis реализация Cache в Redis: кэш общий для всех экземпляров сервиса, поэтому сброс ключа
+// при изменении на одном экземпляре виден остальным. Срок жизни ключей отслеживает сам Redis
+type Redis struct {
+	client *redis.Client
+	// prefix отделяет ключи сервиса от чужих в той же базе Redis
+	prefix string
+}
+
+// NewRedis функция для подключения к Redis по адресу вида redis://[:пароль@]хост:порт/база
+func NewRedis(ctx context.Context, url, prefix string) (*Redis, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	client := redis.NewClient(opt)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &Redis{client: client, prefix: prefix}, nil
+}
+
+// Get функция для чтения значения
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set функция для сохранения значения со сроком жизни
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+// Delete функция для удаления ключей одной командой DEL
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	return r.client.Del(ctx, prefixed...).Err()
+}
+
+// Close функция для закрытия соединений с Redis
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
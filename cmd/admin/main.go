@@ -0,0 +1,358 @@
+// Команда admin — консоль администратора поверх тех же пакетов repository и service, что и сервер:
+// миграции, организации, учётные записи, пользователи и тестовые данные без запросов к работающему API.
+// Настройки подключения берутся так же, как у сервера: DATABASE_URL, CONFIG_FILE и т.д.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/config"
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+	"laba8/service"
+)
+
+// usage текст справки по командам
+const usage = `Usage: admin <command> [flags]
+
+Commands:
+  migrate up|down|reset|version|set_version <version>
+  create-tenant  -slug acme -name "Acme Corp" -admin-username root [-admin-password secret123] [-admin-email root@acme.com]
+  list-tenants
+  create-account -username alice [-password secret123] [-email alice@example.com] [-role viewer] [-tenant default]
+  reset-password -username alice [-password secret123]
+  create-user    -name "John Doe" -email john@example.com [-age 30] [-tenant default]
+  seed           [-count 100] [-prefix seed] [-tenant default]
+
+Without -password (-admin-password) the password is read from the first line of standard input.
+The first admin of a tenant is created by create-tenant; create-account -role admin needs an existing admin.
+Run "admin <command> -h" for the flags of a command.
+`
+
+// app структура зависимостей команд: те же сервисы, что собирает сервер, без HTTP и фоновых задач
+type app struct {
+	db       *pg.DB
+	users    *service.UserService
+	auth     *service.AuthService
+	tenants  *service.TenantService
+	maxBatch int
+}
+
+// command функция выполнения одной команды с её аргументами
+type command func(ctx context.Context, a *app, args []string) error
+
+// commands доступные команды
+var commands = map[string]command{
+	"migrate":        runMigrate,
+	"create-tenant":  createTenant,
+	"list-tenants":   listTenants,
+	"create-account": createAccount,
+	"reset-password": resetPassword,
+	"create-user":    createUser,
+	"seed":           seed,
+}
+
+// errUsage возвращается командой при неверных аргументах; справка уже напечатана
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	// Сообщения хранилища и сервисов идут в stderr в формате сервера, вывод команд — в stdout
+	if err := logging.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	db, err := repository.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	validate := service.NewValidator()
+	a := &app{
+		db: db,
+		users: service.NewUserService(
+			repository.NewUserRepository(db, repository.UserOptions{CostCeiling: cfg.QueryCostCeiling, SkipNoopUpdates: cfg.SkipNoopUpdates}),
+			repository.NewAuditRepository(db),
+			validate,
+			service.UserOptions{MaxSortFields: cfg.MaxSortFields},
+		),
+		auth: service.NewAuthService(
+			repository.NewAccountRepository(db),
+			repository.NewLoginAuditRepository(db),
+			repository.NewTokenRepository(db),
+			repository.NewInviteRepository(db),
+			validate,
+			cfg.JWTSecret,
+			0, 0, 0,
+		),
+		tenants:  service.NewTenantService(repository.NewTenantRepository(db), validate),
+		maxBatch: cfg.MaxImportRows,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cmd(ctx, a, os.Args[2:]); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", os.Args[1], err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+// newFlags функция для создания набора флагов команды; ошибка разбора печатает справку команды
+func newFlags(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// parseFlags функция для разбора флагов команды; обязательные флаги перечисляются в required
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	for _, name := range required {
+		if fs.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(os.Stderr, "Flag -%s is required\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+// inTenant функция для выбора организации, в которой выполняется команда, по её slug
+func (a *app) inTenant(ctx context.Context, slug string) (context.Context, error) {
+	tenantID, err := a.tenants.Resolve(ctx, slug)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("tenant %q does not exist, create it with create-tenant", slug)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repository.WithTenant(ctx, tenantID), nil
+}
+
+// readPassword функция для получения пароля из флага или, если он пуст, из первой строки стандартного ввода,
+// чтобы пароль не оставался в истории команд
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runMigrate функция для выполнения команды миграций, как "migrate" у сервера
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errUsage
+	}
+	oldVersion, newVersion, err := repository.Migrate(a.db, args...)
+	if err != nil {
+		return err
+	}
+	if newVersion != oldVersion {
+		fmt.Printf("Migrated from version %d to %d\n", oldVersion, newVersion)
+	} else {
+		fmt.Printf("Schema version is %d\n", newVersion)
+	}
+	return nil
+}
+
+// createTenant функция для создания организации вместе с её первым администратором — единственный способ
+// получить администратора в организации, где его ещё нет
+func createTenant(ctx context.Context, a *app, args []string) error {
+	fs := newFlags("create-tenant")
+	slug := fs.String("slug", "", "short name for the X-Tenant header")
+	name := fs.String("name", "", "display name")
+	adminUsername := fs.String("admin-username", "", "login name of the first admin")
+	adminPassword := fs.String("admin-password", "", "password of the first admin, read from stdin if empty")
+	adminEmail := fs.String("admin-email", "", "email of the first admin for password recovery")
+	if err := parseFlags(fs, args, "slug", "name", "admin-username"); err != nil {
+		return err
+	}
+	pass, err := readPassword(*adminPassword)
+	if err != nil {
+		return err
+	}
+	tenant := &model.Tenant{Slug: *slug, Name: *name}
+	admin, err := a.tenants.Create(ctx, tenant, service.RegisterRequest{Username: *adminUsername, Password: pass, Email: *adminEmail})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created tenant %d (%s) with admin account %d (%s)\n", tenant.ID, tenant.Slug, admin.ID, admin.Username)
+	return nil
+}
+
+// listTenants функция для вывода всех организаций
+func listTenants(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(newFlags("list-tenants"), args); err != nil {
+		return err
+	}
+	tenants, err := a.tenants.List(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSLUG\tNAME\tCREATED")
+	for _, t := range tenants {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", t.ID, t.Slug, t.Name, t.CreatedAt.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+// createAccount функция для создания учётной записи с заданной ролью
+func createAccount(ctx context.Context, a *app, args []string) error {
+	fs := newFlags("create-account")
+	username := fs.String("username", "", "login name")
+	password := fs.String("password", "", "password, read from stdin if empty")
+	email := fs.String("email", "", "email for password recovery")
+	role := fs.String("role", model.RoleViewer, "admin, editor, viewer or pending")
+	tenant := fs.String("tenant", "default", "tenant slug")
+	if err := parseFlags(fs, args, "username"); err != nil {
+		return err
+	}
+	ctx, err := a.inTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	account, err := a.auth.CreateAccount(ctx, service.RegisterRequest{Username: *username, Password: pass, Email: *email}, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created account %d (%s, %s) in tenant %s\n", account.ID, account.Username, account.Role, *tenant)
+	return nil
+}
+
+// resetPassword функция для смены пароля учётной записи; открытые сессии перестают продлеваться
+func resetPassword(ctx context.Context, a *app, args []string) error {
+	fs := newFlags("reset-password")
+	username := fs.String("username", "", "login name")
+	password := fs.String("password", "", "new password, read from stdin if empty")
+	if err := parseFlags(fs, args, "username"); err != nil {
+		return err
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err := a.auth.SetPassword(ctx, service.SetPasswordRequest{Username: *username, Password: pass}); err != nil {
+		return err
+	}
+	fmt.Printf("Password changed for %s, refresh tokens revoked\n", *username)
+	return nil
+}
+
+// createUser функция для создания пользователя; письмо подтверждения email не отправляется
+func createUser(ctx context.Context, a *app, args []string) error {
+	fs := newFlags("create-user")
+	name := fs.String("name", "", "user name")
+	email := fs.String("email", "", "user email")
+	age := fs.Int("age", 0, "user age")
+	tenant := fs.String("tenant", "default", "tenant slug")
+	if err := parseFlags(fs, args, "name", "email"); err != nil {
+		return err
+	}
+	ctx, err := a.inTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+	user := &model.User{Name: *name, Email: *email, Age: *age}
+	if err := a.users.Create(ctx, user); err != nil {
+		return err
+	}
+	fmt.Printf("Created user %d (%s) in tenant %s\n", user.ID, user.Email, *tenant)
+	return nil
+}
+
+// seedNames имена для тестовых пользователей
+var seedNames = []string{"Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy"}
+
+// seed функция для создания тестовых пользователей пакетным импортом. Адреса строятся из prefix и номера,
+// поэтому повторный запуск с тем же prefix не создаёт дубликатов, а сообщает о занятых email
+func seed(ctx context.Context, a *app, args []string) error {
+	fs := newFlags("seed")
+	count := fs.Int("count", 100, "number of users")
+	prefix := fs.String("prefix", "seed", "email prefix")
+	tenant := fs.String("tenant", "default", "tenant slug")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *count < 1 {
+		fmt.Fprintln(os.Stderr, "Flag -count must be positive")
+		return errUsage
+	}
+	ctx, err := a.inTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	users := make([]model.User, *count)
+	for i := range users {
+		n := seedNames[i%len(seedNames)]
+		users[i] = model.User{
+			Name:  fmt.Sprintf("%s %s %d", n, *prefix, i+1),
+			Email: fmt.Sprintf("%s-%d@example.com", *prefix, i+1),
+			Age:   18 + rand.IntN(60),
+		}
+	}
+	// Импорт идёт порциями по лимиту сервера, чтобы одна транзакция не держала блокировки слишком долго
+	batch := a.maxBatch
+	if batch <= 0 {
+		batch = len(users)
+	}
+	created, failed := 0, 0
+	for start := 0; start < len(users); start += batch {
+		end := min(start+batch, len(users))
+		result, err := a.users.Import(ctx, users[start:end], false, 0)
+		if err != nil {
+			return err
+		}
+		created += result.Created
+		failed += result.Failed
+		for _, rowErr := range result.Errors {
+			fmt.Fprintf(os.Stderr, "Row %d: %v\n", start+rowErr.Row, rowErr.Err)
+		}
+	}
+	fmt.Printf("Seeded %d users in tenant %s, %d failed\n", created, *tenant, failed)
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package events содержит шину событий об изменениях пользователей внутри процесса.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"laba8/model"
+)
+
+// Типы событий об изменениях пользователей
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+	// UserRestored отличается от UserCreated: у пользователя прежний id и история, он снова виден после удаления
+	UserRestored = "user.restored"
+)
+
+// Event структура для хранения события
+type Event struct {
+	// ID в потоке шины растёт монотонно в пределах процесса; в webhook это номер события в outbox,
+	// одинаковый при повторной отправке
+	ID   uint64 `json:"id"`
+	Type string `json:"type"`
+	// TenantID организация пользователя; событие получают только подписчики этой организации
+	TenantID int         `json:"-"`
+	UserID   int         `json:"user_id"`
+	User     *model.User `json:"user,omitempty"`
+	// RequestID запроса, который вызвал изменение
+	RequestID string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// subscriberBuffer сколько событий может ждать отправки одному подписчику
+const subscriberBuffer = 64
+
+// Subscription структура подписки на события; после Close или отключения медленного подписчика канал закрывается
+type Subscription struct {
+	hub      *Hub
+	tenantID int
+	ch       chan Event
+}
+
+// Events функция для получения канала событий подписки
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close функция для отмены подписки; повторный вызов ничего не делает
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub структура шины публикации и подписки. Последние события хранятся в кольцевом буфере,
+// чтобы переподключившийся подписчик получил пропущенное. События не разделяются между экземплярами сервиса
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	lastID  uint64
+	history []Event
+	next    int
+	full    bool
+}
+
+// NewHub функция для создания шины; history — сколько последних событий хранить для переподключений
+func NewHub(history int) *Hub {
+	if history < 1 {
+		history = 1
+	}
+	return &Hub{subs: map[*Subscription]struct{}{}, history: make([]Event, history)}
+}
+
+// Publish функция для рассылки события всем подписчикам; ID присваивается шиной, время — если не задано.
+// Публикация не блокируется: подписчик, который не успевает читать, отключается и может переподключиться
+func (h *Hub) Publish(e Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	e.ID = h.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	h.history[h.next] = e
+	h.next = (h.next + 1) % len(h.history)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	for s := range h.subs {
+		if s.tenantID != e.TenantID {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			h.remove(s)
+		}
+	}
+	return e
+}
+
+// Subscribe функция для подписки на события организации tenantID. Вместе с подпиской возвращаются сохранённые
+// события организации с ID больше lastID; lastID = 0 означает только новые события
+func (h *Hub) Subscribe(tenantID int, lastID uint64) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &Subscription{hub: h, tenantID: tenantID, ch: make(chan Event, subscriberBuffer)}
+	h.subs[s] = struct{}{}
+	if lastID == 0 {
+		return s, nil
+	}
+
+	var missed []Event
+	start, n := 0, h.next
+	if h.full {
+		start, n = h.next, len(h.history)
+	}
+	for i := 0; i < n; i++ {
+		if e := h.history[(start+i)%len(h.history)]; e.ID > lastID && e.TenantID == tenantID {
+			missed = append(missed, e)
+		}
+	}
+	return s, missed
+}
+
+// remove функция для удаления подписчика и закрытия его канала; вызывается под h.mu
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,67 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"laba8/repository"
+	"laba8/service"
+)
+
+// toStatus функция для перевода ошибки сервиса или хранилища в статус gRPC по тем же правилам, что и в REST.
+// Текст ошибок Postgres клиенту не отдаётся
+func toStatus(ctx context.Context, err error, retryTransient bool) error {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		return validationStatus(validationErrs)
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrVersionMismatch):
+		// ABORTED — принятый в gRPC код для конфликта оптимистичной блокировки: клиент перечитывает и повторяет
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, repository.ErrQueryTooExpensive), errors.Is(err, service.ErrInvalidSnapshot),
+		errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidInclude):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		slog.WarnContext(ctx, "gRPC request timed out", "err", err)
+		return status.Error(codes.DeadlineExceeded, "request took too long and was aborted")
+	case retryTransient && repository.IsTransient(err):
+		slog.WarnContext(ctx, "Transient database error", "err", err)
+		return status.Error(codes.Unavailable, "database temporarily unavailable")
+	default:
+		slog.ErrorContext(ctx, "Internal error", "err", err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// validationStatus функция для построения INVALID_ARGUMENT с перечнем полей в деталях BadRequest
+func validationStatus(errs validator.ValidationErrors) error {
+	details := &errdetails.BadRequest{}
+	for _, fe := range errs {
+		msg := fmt.Sprintf("failed the %q rule", fe.Tag())
+		if fe.Param() != "" {
+			msg = fmt.Sprintf("failed the %q rule with %s", fe.Tag(), fe.Param())
+		}
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field(),
+			Description: msg,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, "validation failed").WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "validation failed")
+	}
+	return st.Err()
+}
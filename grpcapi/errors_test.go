@@ -0,0 +1,35 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatusTransient(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		retryTransient bool
+		want           codes.Code
+	}{
+		{"transient with retry", io.ErrUnexpectedEOF, true, codes.Unavailable},
+		{"transient without retry", io.ErrUnexpectedEOF, false, codes.Internal},
+		{"permanent error", errors.New("column does not exist"), true, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(toStatus(context.Background(), tt.err, tt.retryTransient))
+			if st.Code() != tt.want {
+				t.Fatalf("toStatus(%v) code = %v, want %v", tt.err, st.Code(), tt.want)
+			}
+			if st.Code() == codes.Internal && st.Message() != "internal server error" {
+				t.Fatalf("internal status exposes the error: %q", st.Message())
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	userv1 "laba8/api/user/v1"
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+	"laba8/service"
+)
+
+// contextKey тип ключей контекста вызова
+type contextKey string
+
+// claimsKey ключ, под которым в контексте хранятся данные токена
+const claimsKey contextKey = "claims"
+
+// requestIDMetadata ключ метаданных с ID запроса, как заголовок X-Request-ID в REST
+const requestIDMetadata = "x-request-id"
+
+// Роли, которым доступны методы сервиса пользователей; права совпадают с REST
+var (
+	readers = []string{model.RoleAdmin, model.RoleEditor, model.RoleViewer}
+	writers = []string{model.RoleAdmin, model.RoleEditor}
+	admins  = []string{model.RoleAdmin}
+)
+
+// methodRoles права на методы сервиса пользователей; метод сервиса, которого здесь нет, запрещён
+var methodRoles = map[string][]string{
+	userv1.UserService_ListUsers_FullMethodName:  readers,
+	userv1.UserService_GetUser_FullMethodName:    readers,
+	userv1.UserService_CreateUser_FullMethodName: writers,
+	userv1.UserService_UpdateUser_FullMethodName: writers,
+	userv1.UserService_DeleteUser_FullMethodName: admins,
+}
+
+// userServicePrefix префикс полного имени методов сервиса пользователей
+var userServicePrefix = "/" + userv1.UserService_ServiceDesc.ServiceName + "/"
+
+// claimsFromContext функция для получения данных токена из контекста вызова
+func claimsFromContext(ctx context.Context) (*service.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*service.Claims)
+	return claims, ok
+}
+
+// requestIDInterceptor функция для присвоения вызову ID и возврата его в заголовке ответа; ID попадает во все логи вызова
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	return handler(logging.WithRequestID(ctx, id), req)
+}
+
+// newRequestID функция для генерации случайного ID вызова
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// loggingInterceptor функция для логирования каждого вызова: метод, код ответа, время и ID запроса
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+	slog.Log(ctx, level, "gRPC request", "method", info.FullMethod, "code", code.String(), "duration", time.Since(start))
+	return resp, err
+}
+
+// recoveryInterceptor функция для перевода паники обработчика в ответ INTERNAL
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(ctx, "Panic in gRPC handler", "method", info.FullMethod, "panic", p, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// streamRecoveryInterceptor функция для перевода паники потокового обработчика (health Watch, reflection) в INTERNAL
+func streamRecoveryInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(ss.Context(), "Panic in gRPC stream", "method", info.FullMethod, "panic", p, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// timeoutInterceptor функция для ограничения времени обработки вызова, как REQUEST_TIMEOUT в REST
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// authInterceptor функция для проверки access-токена и роли на методах сервиса пользователей.
+// Health и reflection открыты, чтобы ими можно было пользоваться без токена
+func authInterceptor(auth *service.AuthService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, userServicePrefix) {
+			return handler(ctx, req)
+		}
+		roles, ok := methodRoles[info.FullMethod]
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "method is not allowed")
+		}
+
+		var tokenStr string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				tokenStr, _ = strings.CutPrefix(values[0], "Bearer ")
+			}
+		}
+		if tokenStr == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+		claims, err := auth.VerifyToken(ctx, tokenStr)
+		if errors.Is(err, service.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if err != nil {
+			// Список отозванных токенов недоступен: пускать с непроверенным токеном нельзя
+			slog.ErrorContext(ctx, "Token check failed", "method", info.FullMethod, "err", err)
+			return nil, status.Error(codes.Unavailable, "token check is temporarily unavailable")
+		}
+
+		allowed := false
+		for _, role := range roles {
+			if claims.Role == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, status.Error(codes.PermissionDenied, "insufficient role for this operation")
+		}
+
+		ctx = context.WithValue(ctx, claimsKey, claims)
+		// Вызовы работают только с организацией токена; заголовка X-Tenant в gRPC нет
+		ctx = repository.WithTenant(ctx, claims.Tenant())
+		ctx = logging.With(ctx, slog.Int("account_id", claims.AccountID), slog.Int("tenant_id", claims.Tenant()))
+		// Автор изменений для журнала, как в REST
+		ctx = repository.WithActor(ctx, repository.Actor{
+			AccountID: claims.AccountID,
+			Username:  claims.Username,
+			RequestID: logging.RequestID(ctx),
+		})
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,193 @@
+// Package grpcapi содержит gRPC-сервер с тем же CRUD пользователей, что и REST, поверх общего сервисного слоя.
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userv1 "laba8/api/user/v1"
+	"laba8/model"
+	"laba8/service"
+)
+
+// Deps структура зависимостей gRPC-сервера
+type Deps struct {
+	Users        *service.UserService
+	Verification *service.VerificationService
+	Auth         *service.AuthService
+	// RequestTimeout предельное время обработки вызова, 0 — без ограничения
+	RequestTimeout time.Duration
+	// RetryTransient отдавать временные ошибки базы как UNAVAILABLE, чтобы клиент повторил вызов
+	RetryTransient bool
+	// TLS настройки TLS, общие с HTTPS; nil — вызовы без шифрования
+	TLS *tls.Config
+}
+
+// userServer реализация userv1.UserServiceServer
+type userServer struct {
+	userv1.UnimplementedUserServiceServer
+	deps Deps
+}
+
+// NewServer функция для создания gRPC-сервера с сервисом пользователей, health и reflection.
+// Health-сервер возвращается отдельно, чтобы при остановке перевести его в NOT_SERVING
+func NewServer(deps Deps) (*grpc.Server, *health.Server) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			requestIDInterceptor,
+			loggingInterceptor,
+			recoveryInterceptor,
+			timeoutInterceptor(deps.RequestTimeout),
+			authInterceptor(deps.Auth),
+		),
+		grpc.ChainStreamInterceptor(streamRecoveryInterceptor),
+	}
+	if deps.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(deps.TLS)))
+	}
+	srv := grpc.NewServer(opts...)
+	userv1.RegisterUserServiceServer(srv, &userServer{deps: deps})
+
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthSrv.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthSrv)
+
+	// Reflection позволяет grpcurl обходиться без .proto-файлов
+	reflection.Register(srv)
+	return srv, healthSrv
+}
+
+// maxListLimit наибольший размер страницы ListUsers, как у GET /users
+const maxListLimit = 100
+
+// ListUsers функция для получения страницы пользователей с фильтрами и сортировкой, как GET /users
+func (s *userServer) ListUsers(ctx context.Context, req *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	if err := checkIncludeDeleted(ctx, req.GetIncludeDeleted()); err != nil {
+		return nil, err
+	}
+	page, limit := int(req.GetPage()), int(req.GetLimit())
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	limit = min(limit, maxListLimit)
+	params := service.ListParams{
+		Page:           page,
+		Limit:          limit,
+		Name:           req.GetName(),
+		NameLike:       req.GetNameLike(),
+		Age:            optionalInt(req.Age),
+		AgeGte:         optionalInt(req.AgeGte),
+		AgeLte:         optionalInt(req.AgeLte),
+		Verified:       req.Verified,
+		Sort:           req.GetSort(),
+		IncludeDeleted: req.GetIncludeDeleted(),
+	}
+	result, err := s.deps.Users.List(ctx, params)
+	if err != nil {
+		return nil, toStatus(ctx, err, s.deps.RetryTransient)
+	}
+
+	resp := &userv1.ListUsersResponse{
+		Users:      make([]*userv1.User, 0, len(result.Users)),
+		Total:      int32(result.Total),
+		Page:       int32(page),
+		Limit:      int32(limit),
+		TotalPages: int32((result.Total + limit - 1) / limit),
+	}
+	for i := range result.Users {
+		resp.Users = append(resp.Users, toProto(&result.Users[i]))
+	}
+	return resp, nil
+}
+
+// GetUser функция для получения пользователя по ID
+func (s *userServer) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
+	if err := checkIncludeDeleted(ctx, req.GetIncludeDeleted()); err != nil {
+		return nil, err
+	}
+	user, err := s.deps.Users.Get(ctx, int(req.GetId()), service.GetParams{IncludeDeleted: req.GetIncludeDeleted()})
+	if err != nil {
+		return nil, toStatus(ctx, err, s.deps.RetryTransient)
+	}
+	return &userv1.GetUserResponse{User: toProto(user)}, nil
+}
+
+// CreateUser функция для создания пользователя; как и в REST, ему уходит письмо подтверждения email
+func (s *userServer) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
+	user := &model.User{Name: req.GetName(), Email: req.GetEmail(), Age: int(req.GetAge())}
+	if err := s.deps.Users.Create(ctx, user); err != nil {
+		return nil, toStatus(ctx, err, s.deps.RetryTransient)
+	}
+	if s.deps.Verification != nil {
+		s.deps.Verification.SendAsync(ctx, user)
+	}
+	return &userv1.CreateUserResponse{User: toProto(user)}, nil
+}
+
+// UpdateUser функция для замены пользователя с проверкой версии
+func (s *userServer) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.UpdateUserResponse, error) {
+	if req.GetVersion() < 1 {
+		return nil, status.Error(codes.FailedPrecondition, "version is required, send the version from GetUser")
+	}
+	user := &model.User{ID: int(req.GetId()), Name: req.GetName(), Email: req.GetEmail(), Age: int(req.GetAge())}
+	if err := s.deps.Users.Update(ctx, user, int(req.GetVersion())); err != nil {
+		return nil, toStatus(ctx, err, s.deps.RetryTransient)
+	}
+	return &userv1.UpdateUserResponse{User: toProto(user)}, nil
+}
+
+// DeleteUser функция для мягкого удаления пользователя
+func (s *userServer) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
+	id := int(req.GetId())
+	if err := s.deps.Users.Delete(ctx, id); err != nil {
+		return nil, toStatus(ctx, err, s.deps.RetryTransient)
+	}
+	return &userv1.DeleteUserResponse{}, nil
+}
+
+// checkIncludeDeleted функция для проверки, что мягко удалённых запрашивает администратор
+func checkIncludeDeleted(ctx context.Context, include bool) error {
+	if claims, _ := claimsFromContext(ctx); include && (claims == nil || claims.Role != model.RoleAdmin) {
+		return status.Error(codes.PermissionDenied, "only admins can include deleted users")
+	}
+	return nil
+}
+
+// toProto функция для перевода пользователя в сообщение protobuf
+func toProto(user *model.User) *userv1.User {
+	msg := &userv1.User{
+		Id:       int64(user.ID),
+		Name:     user.Name,
+		Email:    user.Email,
+		Age:      int32(user.Age),
+		Verified: user.Verified,
+		Version:  int32(user.Version),
+	}
+	if user.DeletedAt != nil {
+		msg.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	return msg
+}
+
+// optionalInt функция для перевода необязательного поля protobuf в фильтр сервиса
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	n := int(*v)
+	return &n
+}
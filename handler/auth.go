@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"laba8/model"
+	"laba8/service"
+)
+
+// registerHandler функция для регистрации новой учётной записи по приглашению
+func (h *Handler) registerHandler(w http.ResponseWriter, r *http.Request) {
+	var req service.RegisterRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	account, pair, err := h.auth.Register(r.Context(), req)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		Account *model.Account `json:"account"`
+		*service.TokenPair
+	}{account, pair})
+}
+
+// loginHandler функция для обработки авторизации
+func (h *Handler) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var authReq service.AuthRequest
+	if !h.decodeJSON(w, r, &authReq) {
+		return
+	}
+
+	pair, err := h.auth.Login(r.Context(), authReq, loginMeta(r))
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		slog.WarnContext(r.Context(), "Failed login attempt", "username", authReq.Username)
+	}
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// refreshHandler функция для обмена refresh-токена на новую пару токенов
+func (h *Handler) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req service.RefreshRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	pair, err := h.auth.Refresh(r.Context(), req)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// logoutHandler функция для выхода: отзывает текущий access-токен и refresh-токены его сессии
+func (h *Handler) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := claimsFromContext(r.Context())
+	if err := h.auth.Logout(r.Context(), claims); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgotPasswordHandler функция для запроса сброса пароля; ответ одинаков для известных и неизвестных адресов
+func (h *Handler) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req service.ForgotPasswordRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.passwords.Forgot(r.Context(), req); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "If the email is registered, a reset token has been sent"})
+}
+
+// resetPasswordHandler функция для установки нового пароля по токену из письма
+func (h *Handler) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req service.ResetPasswordRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.passwords.Reset(r.Context(), req); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
+
+// loginMeta функция для получения сведений о клиенте для аудита входа
+func loginMeta(r *http.Request) service.LoginMeta {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return service.LoginMeta{IP: ip, UserAgent: r.UserAgent()}
+}
+
+// createInviteHandler функция для выдачи приглашения в свою организацию (только для администраторов);
+// токен приглашения есть только в этом ответе
+func (h *Handler) createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var req service.InviteRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	invite, token, err := h.auth.CreateInvite(r.Context(), req)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		*model.Invite
+		Token string `json:"token"`
+	}{invite, token})
+}
+
+// loginAuditsHandler функция для просмотра журнала попыток входа своей организации (только для администраторов).
+// Фильтры ?username=, ?account_id=, ?ip=, ?success=, ?since= и ?until= (RFC 3339), размер ?limit= (по умолчанию 50)
+func (h *Handler) loginAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := service.LoginAuditParams{
+		Username: query.Get("username"),
+		IP:       query.Get("ip"),
+		Limit:    50,
+	}
+	var err error
+	if params.AccountID, err = queryInt(query, "account_id"); err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(query, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	if limit != nil {
+		params.Limit = *limit
+	}
+	if v := query.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameter success must be a boolean")
+			return
+		}
+		params.Success = &success
+	}
+	for name, dst := range map[string]**time.Time{"since": &params.Since, "until": &params.Until} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Parameter %s must be an RFC 3339 timestamp", name))
+			return
+		}
+		*dst = &t
+	}
+
+	audits, err := h.auth.LoginAudits(r.Context(), params)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if audits == nil {
+		audits = []model.LoginAudit{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": audits})
+}
+
+// assignRoleHandler функция для назначения роли учётной записи (только для администраторов)
+func (h *Handler) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Invalid account id")
+		return
+	}
+	var req service.RoleRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	account, err := h.auth.AssignRole(r.Context(), id, req)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
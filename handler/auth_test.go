@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"laba8/model"
+	"laba8/service"
+)
+
+// login функция для входа учётной записи с паролем из memAccounts
+func login(t *testing.T, env *testEnv, username string) service.TokenPair {
+	t.Helper()
+	rec := env.call("POST", "/login", "", fmt.Sprintf(`{"username":%q,"password":"secret123"}`, username))
+	checkStatus(t, rec, http.StatusOK)
+	var pair service.TokenPair
+	decodeBody(t, rec, &pair)
+	return pair
+}
+
+func TestLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	pair := login(t, env, model.RoleEditor)
+	if pair.AccessToken == "" || pair.RefreshToken == "" || pair.TokenType != "Bearer" {
+		t.Fatalf("token pair = %+v", pair)
+	}
+	checkStatus(t, env.call("GET", "/users", pair.AccessToken, ""), http.StatusOK)
+
+	// Ответ на неверный пароль и неизвестное имя одинаков
+	for _, body := range []string{
+		`{"username":"editor","password":"wrong-password"}`,
+		`{"username":"nobody","password":"secret123"}`,
+	} {
+		apiErr := checkError(t, env.call("POST", "/login", "", body), http.StatusUnauthorized, CodeUnauthorized)
+		if apiErr.Message != "Invalid username or password" {
+			t.Fatalf("login error message = %q", apiErr.Message)
+		}
+	}
+	checkError(t, env.call("POST", "/login", "", `{"username":"editor","password":"secret123","remember":true}`),
+		http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	env := newTestEnv(t)
+	pair := login(t, env, model.RoleViewer)
+
+	checkError(t, env.call("POST", "/auth/refresh", "", `{"refresh_token":""}`), http.StatusUnauthorized, CodeUnauthorized)
+	checkError(t, env.call("POST", "/auth/refresh", "", `{"refresh_token":"unknown"}`), http.StatusUnauthorized, CodeUnauthorized)
+
+	body := fmt.Sprintf(`{"refresh_token":%q}`, pair.RefreshToken)
+	rec := env.call("POST", "/auth/refresh", "", body)
+	checkStatus(t, rec, http.StatusOK)
+	var rotated service.TokenPair
+	decodeBody(t, rec, &rotated)
+	// Повторное предъявление использованного токена отзывает всю сессию
+	checkError(t, env.call("POST", "/auth/refresh", "", body), http.StatusUnauthorized, CodeUnauthorized)
+	checkError(t, env.call("POST", "/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, rotated.RefreshToken)),
+		http.StatusUnauthorized, CodeUnauthorized)
+
+	checkError(t, env.call("POST", "/auth/logout", "", ""), http.StatusUnauthorized, CodeUnauthorized)
+	checkStatus(t, env.call("POST", "/auth/logout", rotated.AccessToken, ""), http.StatusNoContent)
+	// Отозванный токен больше не принимается
+	checkError(t, env.call("GET", "/users", rotated.AccessToken, ""), http.StatusUnauthorized, CodeUnauthorized)
+}
+
+func TestRevocationListUnavailable(t *testing.T) {
+	env := newTestEnv(t)
+	// Без проверки отзыва пускать с токеном нельзя: временный сбой отдаётся как 503
+	env.tokens.err = io.ErrUnexpectedEOF
+	rec := env.call("GET", "/users", env.token(t, model.RoleViewer), "")
+	checkError(t, rec, http.StatusServiceUnavailable, CodeUnavailable)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("503 without Retry-After")
+	}
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.token(t, model.RoleAdmin)
+
+	checkError(t, env.call("POST", "/register", "", `{"username":"newbie","password":"secret123"}`),
+		http.StatusForbidden, CodeForbidden)
+	checkError(t, env.call("POST", "/register", "", `{"username":"newbie","password":"secret123","invite_token":"guess"}`),
+		http.StatusBadRequest, CodeBadRequest)
+
+	checkError(t, env.call("POST", "/admin/invites", env.token(t, model.RoleEditor), `{"role":"viewer"}`),
+		http.StatusForbidden, CodeForbidden)
+	checkError(t, env.call("POST", "/admin/invites", admin, `{"role":"owner"}`), http.StatusBadRequest, CodeValidationFailed)
+	rec := env.call("POST", "/admin/invites", admin, `{"role":"editor"}`)
+	checkStatus(t, rec, http.StatusCreated)
+	var invite struct {
+		model.Invite
+		Token string `json:"token"`
+	}
+	decodeBody(t, rec, &invite)
+	if invite.Token == "" || invite.Role != model.RoleEditor {
+		t.Fatalf("invite = %+v, want an editor invite with a token", invite)
+	}
+
+	checkError(t, env.call("POST", "/register", "", fmt.Sprintf(`{"username":"nb","password":"short","invite_token":%q}`, invite.Token)),
+		http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("POST", "/register", "", fmt.Sprintf(`{"username":"viewer","password":"secret123","invite_token":%q}`, invite.Token)),
+		http.StatusConflict, CodeConflict)
+
+	rec = env.call("POST", "/register", "", fmt.Sprintf(`{"username":"newbie","password":"secret123","invite_token":%q}`, invite.Token))
+	checkStatus(t, rec, http.StatusCreated)
+	var registered struct {
+		Account model.Account `json:"account"`
+		service.TokenPair
+	}
+	decodeBody(t, rec, &registered)
+	if registered.Account.Role != model.RoleEditor || registered.AccessToken == "" {
+		t.Fatalf("registered %+v, want an editor with a token", registered)
+	}
+	// Приглашение одноразовое
+	checkError(t, env.call("POST", "/register", "", fmt.Sprintf(`{"username":"another","password":"secret123","invite_token":%q}`, invite.Token)),
+		http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestPasswordReset(t *testing.T) {
+	env := newTestEnv(t)
+
+	checkError(t, env.call("POST", "/auth/forgot-password", "", `{"email":"not-an-email"}`), http.StatusBadRequest, CodeValidationFailed)
+	// Ответ не выдаёт, зарегистрирован ли адрес
+	for _, email := range []string{"viewer@example.com", "nobody@example.com"} {
+		checkStatus(t, env.call("POST", "/auth/forgot-password", "", fmt.Sprintf(`{"email":%q}`, email)), http.StatusAccepted)
+	}
+
+	checkError(t, env.call("POST", "/auth/reset-password", "", `{"token":"t","password":"short"}`), http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("POST", "/auth/reset-password", "", `{"token":"expired","password":"secret1234"}`), http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestAssignRole(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.token(t, model.RoleAdmin)
+	path := fmt.Sprintf("/admin/accounts/%d/role", testAccounts[model.RolePending])
+
+	checkError(t, env.call("PUT", path, "", `{"role":"viewer"}`), http.StatusUnauthorized, CodeUnauthorized)
+	checkError(t, env.call("PUT", path, env.token(t, model.RoleEditor), `{"role":"viewer"}`), http.StatusForbidden, CodeForbidden)
+	checkError(t, env.call("PUT", "/admin/accounts/abc/role", admin, `{"role":"viewer"}`), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("PUT", path, admin, `{"role":"owner"}`), http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("PUT", "/admin/accounts/999/role", admin, `{"role":"viewer"}`), http.StatusNotFound, CodeNotFound)
+
+	rec := env.call("PUT", path, admin, `{"role":"viewer"}`)
+	checkStatus(t, rec, http.StatusOK)
+	var account model.Account
+	decodeBody(t, rec, &account)
+	if account.Role != model.RoleViewer {
+		t.Fatalf("role = %q, want viewer", account.Role)
+	}
+}
+
+func TestLoginAudits(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.token(t, model.RoleAdmin)
+	login(t, env, model.RoleViewer)
+	env.call("POST", "/login", "", `{"username":"viewer","password":"wrong-password"}`)
+
+	checkError(t, env.call("GET", "/admin/login-audits", env.token(t, model.RoleViewer), ""), http.StatusForbidden, CodeForbidden)
+	for _, query := range []string{"account_id=me", "limit=many", "success=sometimes", "since=yesterday", "until=2024-01-01"} {
+		checkError(t, env.call("GET", "/admin/login-audits?"+query, admin, ""), http.StatusBadRequest, CodeBadRequest)
+	}
+
+	rec := env.call("GET", "/admin/login-audits?since=2024-01-01T00:00:00Z&success=false", admin, "")
+	checkStatus(t, rec, http.StatusOK)
+	var resp struct {
+		Data []model.LoginAudit `json:"data"`
+	}
+	decodeBody(t, rec, &resp)
+	if len(resp.Data) != 2 {
+		t.Fatalf("login audits = %+v, want both attempts", resp.Data)
+	}
+	if strings.Contains(rec.Body.String(), "wrong-password") {
+		t.Fatal("login audit exposes the attempted password")
+	}
+}
+
+func TestTenantHeader(t *testing.T) {
+	env := newTestEnv(t)
+
+	req := newRequest("POST", "/login", "", `{"username":"viewer","password":"secret123"}`)
+	req.Header.Set(tenantHeader, "unknown")
+	checkError(t, env.serve(req), http.StatusBadRequest, CodeBadRequest)
+
+	// X-Tenant с токеном может только подтвердить организацию токена
+	req = newRequest("GET", "/users", env.token(t, model.RoleViewer), "")
+	req.Header.Set(tenantHeader, "acme")
+	checkError(t, env.serve(req), http.StatusForbidden, CodeForbidden)
+	req.Header.Set(tenantHeader, "default")
+	checkStatus(t, env.serve(req), http.StatusOK)
+}
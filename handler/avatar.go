@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// avatarCacheControl политика кэширования аватара: адрес не меняется при новой загрузке,
+// поэтому клиент перепроверяет файл по ETag после короткого срока
+const avatarCacheControl = "private, max-age=300, must-revalidate"
+
+// uploadAvatar функция для загрузки аватара из поля avatar формы multipart/form-data
+func (h *Handler) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	// Запас на заголовки multipart сверх размера самого файла
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.AvatarMaxBytes)+64<<10)
+	file, _, err := r.FormFile("avatar")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "Avatar file is too large")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Form field avatar with an image file is required")
+		return
+	}
+	defer file.Close()
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(h.cfg.AvatarMaxBytes)+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Failed to read avatar file")
+		return
+	}
+	if len(data) > h.cfg.AvatarMaxBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "Avatar file is too large")
+		return
+	}
+
+	profile, err := h.avatars.Upload(r.Context(), id, data)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// getAvatar функция для отдачи аватара (?size=thumb — миниатюра) с заголовками кэширования;
+// If-None-Match и If-Modified-Since дают ответ 304
+func (h *Handler) getAvatar(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	obj, err := h.avatars.Get(r.Context(), id, r.URL.Query().Get("size") == "thumb")
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	w.Header().Set("Content-Type", obj.Info.ContentType)
+	w.Header().Set("ETag", obj.Info.ETag)
+	w.Header().Set("Cache-Control", avatarCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if body, ok := obj.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", obj.Info.LastModified, body)
+		return
+	}
+	// Хранилище без произвольного доступа: Range не поддерживается, содержимое читается целиком
+	data, err := io.ReadAll(obj.Body)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	http.ServeContent(w, r, "", obj.Info.LastModified, bytes.NewReader(data))
+}
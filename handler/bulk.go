@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/model"
+	"laba8/service"
+)
+
+// maxImportMemory объём multipart-формы, который держится в памяти; остальное уходит во временные файлы
+const maxImportMemory = 32 << 20
+
+// importRowError структура для хранения ошибки строки в отчёте об импорте
+type importRowError struct {
+	Row     int          `json:"row"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// importResponse структура отчёта об импорте
+type importResponse struct {
+	Mode    string           `json:"mode"`
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Errors  []importRowError `json:"errors"`
+	Users   []*model.User    `json:"users"`
+}
+
+// bulkCreateUsers функция для пакетного создания пользователей из JSON-массива или CSV-файла.
+// mode=atomic (по умолчанию) сохраняет всё или ничего, mode=partial сохраняет корректные строки и сообщает об остальных;
+// async=true выполняет импорт фоновой задачей
+func (h *Handler) bulkCreateUsers(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "atomic"
+	}
+	if mode != "atomic" && mode != "partial" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameter mode must be atomic or partial")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.MaxImportBytes))
+	users, err := readImport(r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		h.queueImport(w, r, mode, users)
+		return
+	}
+
+	result, err := h.users.Import(r.Context(), users, mode == "atomic", h.cfg.MaxImportRows)
+	if errors.Is(err, service.ErrTooManyRows) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, capitalize(err.Error()))
+		return
+	}
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+
+	resp := importReport(mode, result)
+	status := http.StatusCreated
+	switch {
+	case mode == "atomic" && result.Failed > 0:
+		status = http.StatusUnprocessableEntity
+	case result.Failed > 0:
+		status = http.StatusOK
+	}
+	writeJSON(w, status, resp)
+}
+
+// importJob структура входных данных задачи асинхронного импорта
+type importJob struct {
+	Mode  string       `json:"mode"`
+	Users []model.User `json:"users"`
+}
+
+// queueImport функция для постановки импорта в очередь фоновых задач (?async=true): ответ 202 с задачей,
+// отчёт появляется в result задачи GET /jobs/{id}
+func (h *Handler) queueImport(w http.ResponseWriter, r *http.Request, mode string, users []model.User) {
+	// Лимит строк проверяется сразу, чтобы не ставить в очередь заведомо отклонённый импорт
+	if err := service.CheckImportSize(len(users), h.cfg.MaxImportRows); err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, capitalize(err.Error()))
+		return
+	}
+	job, err := h.jobs.Enqueue(r.Context(), service.JobImportUsers, importJob{Mode: mode, Users: users})
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// runImportJob функция для выполнения задачи асинхронного импорта; итог — тот же отчёт, что и у синхронного
+func (h *Handler) runImportJob(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var job importJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return nil, fmt.Errorf("%w: decode import: %v", service.ErrJobPermanent, err)
+	}
+	result, err := h.users.Import(ctx, job.Users, job.Mode == "atomic", h.cfg.MaxImportRows)
+	if errors.Is(err, service.ErrTooManyRows) {
+		return nil, fmt.Errorf("%w: %v", service.ErrJobPermanent, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return importReport(job.Mode, result), nil
+}
+
+// importReport функция для построения отчёта об импорте
+func importReport(mode string, result *service.ImportResult) importResponse {
+	resp := importResponse{
+		Mode:    mode,
+		Created: result.Created,
+		Failed:  result.Failed,
+		Errors:  make([]importRowError, 0, len(result.Errors)),
+		Users:   result.Users,
+	}
+	for _, rowErr := range result.Errors {
+		resp.Errors = append(resp.Errors, describeRowError(rowErr))
+	}
+	if resp.Users == nil {
+		resp.Users = []*model.User{}
+	}
+	return resp
+}
+
+// describeRowError функция для перевода ошибки строки импорта в элемент отчёта
+func describeRowError(rowErr service.ImportRowError) importRowError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(rowErr.Err, &validationErrs) {
+		details := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			details = append(details, FieldError{Field: fe.Field(), Message: fieldMessage(fe)})
+		}
+		return importRowError{Row: rowErr.Row, Message: "Validation failed", Details: details}
+	}
+	return importRowError{Row: rowErr.Row, Message: capitalize(rowErr.Err.Error())}
+}
+
+// readImport функция для чтения строк импорта: JSON-массив, CSV в теле запроса или CSV-файл в поле file формы.
+// JSON разбирается так же строго, как тела остальных запросов
+func readImport(r *http.Request) ([]model.User, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if err := checkJSONContentType(r); err != nil {
+			return nil, err
+		}
+		var users []model.User
+		if err := decodeStrict(r.Body, &users); err != nil {
+			return nil, err
+		}
+		return users, nil
+	case "text/csv":
+		return readCSV(r.Body)
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxImportMemory); err != nil {
+			return nil, fmt.Errorf("Invalid multipart form: %w", err)
+		}
+		defer r.MultipartForm.RemoveAll()
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("Form field file with a CSV upload is required")
+		}
+		defer file.Close()
+		return readCSV(file)
+	default:
+		return nil, &bodyError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    CodeUnsupportedMedia,
+			message: fmt.Sprintf("Unsupported Content-Type %q, use application/json, text/csv or multipart/form-data", mediaType),
+		}
+	}
+}
+
+// readCSV функция для разбора CSV с заголовком; колонки name, email, age могут идти в любом порядке
+func readCSV(src io.Reader) ([]model.User, error) {
+	reader := csv.NewReader(src)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "email"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must contain a %q column", name)
+		}
+	}
+	ageCol, hasAge := columns["age"]
+
+	var users []model.User
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %w", err)
+		}
+		user := model.User{
+			Name:  record[columns["name"]],
+			Email: record[columns["email"]],
+		}
+		if hasAge && strings.TrimSpace(record[ageCol]) != "" {
+			if user.Age, err = strconv.Atoi(strings.TrimSpace(record[ageCol])); err != nil {
+				return nil, fmt.Errorf("CSV line %d: age must be an integer", line)
+			}
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
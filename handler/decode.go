@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// bodyError структура ошибки разбора тела запроса с готовым ответом клиенту
+type bodyError struct {
+	status  int
+	code    string
+	message string
+	details []FieldError
+}
+
+func (e *bodyError) Error() string {
+	return e.message
+}
+
+// badBody функция для создания ошибки тела запроса с ответом 400
+func badBody(message string, details ...FieldError) *bodyError {
+	return &bodyError{status: http.StatusBadRequest, code: CodeBadRequest, message: message, details: details}
+}
+
+// decodeJSON функция для строгого разбора JSON-тела запроса: Content-Type application/json, размер не больше
+// MAX_BODY_BYTES, без неизвестных полей и данных после значения. При ошибке отправляет ответ и возвращает false
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := checkJSONContentType(r); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.MaxBodyBytes))
+	if err := decodeStrict(r.Body, dst); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	return true
+}
+
+// checkJSONContentType функция для проверки, что тело запроса объявлено как JSON в UTF-8
+func checkJSONContentType(r *http.Request) error {
+	header := r.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(header)
+	if header == "" || err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return &bodyError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    CodeUnsupportedMedia,
+			message: "Content-Type must be application/json",
+		}
+	}
+	if charset := params["charset"]; charset != "" && !strings.EqualFold(charset, "utf-8") {
+		return &bodyError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    CodeUnsupportedMedia,
+			message: "JSON body must be encoded in UTF-8",
+		}
+	}
+	return nil
+}
+
+// decodeStrict функция для разбора ровно одного JSON-значения: неизвестные поля и данные после значения
+// считаются ошибкой клиента, а не молча отбрасываются
+func decodeStrict(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return describeDecodeError(err, dst)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return describeDecodeError(err, dst)
+		}
+		return badBody("Request body must contain a single JSON value")
+	}
+	return nil
+}
+
+// describeDecodeError функция для перевода ошибки encoding/json в понятное сообщение с указанием поля
+func describeDecodeError(err error, dst interface{}) error {
+	var (
+		maxBytesErr *http.MaxBytesError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &bodyError{
+			status:  http.StatusRequestEntityTooLarge,
+			code:    CodeTooLarge,
+			message: fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return badBody("Request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badBody("Request body contains incomplete JSON")
+	case errors.As(err, &syntaxErr):
+		return badBody(fmt.Sprintf("Request body contains malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return badBody("Request body must be " + jsonKind(reflect.TypeOf(dst)))
+		}
+		return badBody(fmt.Sprintf("Field %q has the wrong type", typeErr.Field),
+			FieldError{Field: typeErr.Field, Message: "must be " + jsonKind(typeErr.Type)})
+	}
+	// Текст ошибки неизвестного поля в encoding/json не вынесен в отдельный тип
+	if quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field, uErr := strconv.Unquote(quoted)
+		if uErr != nil {
+			field = quoted
+		}
+		return badBody(fmt.Sprintf("Unknown field %q", field), FieldError{Field: field, Message: "is not a known field"})
+	}
+	return badBody("Invalid request body: " + err.Error())
+}
+
+// jsonKind функция для описания ожидаемого JSON-типа для сообщения об ошибке
+func jsonKind(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "a JSON value"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	default:
+		return "a JSON value"
+	}
+}
+
+// writeBodyError функция для ответа на ошибку чтения тела; прочие ошибки считаются ошибками клиента (400)
+func writeBodyError(w http.ResponseWriter, err error) {
+	var bodyErr *bodyError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &bodyErr):
+		writeJSONError(w, bodyErr.status, APIError{Code: bodyErr.code, Message: bodyErr.message, Details: bodyErr.details})
+	case errors.As(err, &maxBytesErr):
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge,
+			fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit))
+	default:
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// openAPISpec спецификация OpenAPI 3, которая ведётся вручную вместе с маршрутами
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage страница Swagger UI; сами скрипты и стили загружаются с CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>laba8 API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui", persistAuthorization: true});
+  </script>
+</body>
+</html>
+`
+
+// openAPIHandler функция для отдачи спецификации OpenAPI
+func (h *Handler) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(openAPISpec)
+}
+
+// docsHandler функция для отдачи страницы Swagger UI
+func (h *Handler) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+// checkOpenAPI функция для сверки маршрутов со спецификацией при сборке маршрутизатора:
+// маршрут, которого нет в openapi.json, попадает в лог, чтобы спецификация не отставала от кода
+func checkOpenAPI(router *mux.Router) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		slog.Error("Embedded openapi.json is invalid", "err", err)
+		return
+	}
+	var missing []string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		// У префиксов подмаршрутизаторов методов нет, это не отдельные маршруты
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if _, ok := spec.Paths[tpl][strings.ToLower(method)]; !ok {
+				missing = append(missing, method+" "+tpl)
+			}
+		}
+		return nil
+	})
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		slog.Warn("Routes missing from openapi.json", "routes", strings.Join(missing, ", "))
+	}
+}
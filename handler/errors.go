@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/repository"
+	"laba8/service"
+)
+
+// Коды ошибок в ответах API
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodePrecondition     = "precondition_failed"
+	CodePreconditionReq  = "precondition_required"
+	CodeURITooLong       = "uri_too_long"
+	CodeTooLarge         = "payload_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+	CodeTimeout          = "timeout"
+)
+
+// FieldError структура для хранения ошибки валидации отдельного поля
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError структура для хранения тела ответа с ошибкой
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// errorResponse структура конверта ответа с ошибкой
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeJSON функция для отправки JSON-ответа с кодом status; заголовки ответа задаются до вызова
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError функция для отправки ошибки в едином JSON-формате
+func writeJSONError(w http.ResponseWriter, status int, apiErr APIError) {
+	writeJSON(w, status, errorResponse{Error: apiErr})
+}
+
+// writeError функция для отправки ошибки с кодом и сообщением
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSONError(w, status, APIError{Code: code, Message: message})
+}
+
+// writeValidationError функция для отправки ошибок валидатора с сообщениями по каждому полю
+func writeValidationError(w http.ResponseWriter, validationErrs validator.ValidationErrors) {
+	details := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		details = append(details, FieldError{Field: fe.Field(), Message: fieldMessage(fe)})
+	}
+	writeJSONError(w, http.StatusBadRequest, APIError{
+		Code:    CodeValidationFailed,
+		Message: "Validation failed",
+		Details: details,
+	})
+}
+
+// fieldMessage функция для получения понятного сообщения об ошибке правила валидации
+func fieldMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an http or https URL"
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
+
+// writeServiceError функция для перевода ошибки сервиса или хранилища в HTTP-ответ.
+// Временные ошибки базы отдаются как 503 с Retry-After, текст ошибок Postgres клиенту не отдаётся
+func (h *Handler) writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		writeValidationError(w, validationErrs)
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, http.StatusNotFound, CodeNotFound, capitalize(err.Error()))
+	case errors.Is(err, repository.ErrConflict):
+		writeError(w, http.StatusConflict, CodeConflict, capitalize(err.Error()))
+	case errors.Is(err, service.ErrUnsupportedImage):
+		writeError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, capitalize(err.Error()))
+	case errors.Is(err, service.ErrImageTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, capitalize(err.Error()))
+	case errors.Is(err, service.ErrInviteRequired):
+		writeError(w, http.StatusForbidden, CodeForbidden, capitalize(err.Error()))
+	case errors.Is(err, repository.ErrResetTokenInvalid), errors.Is(err, repository.ErrInviteInvalid):
+		writeError(w, http.StatusBadRequest, CodeBadRequest, capitalize(err.Error()))
+	case errors.Is(err, repository.ErrVersionMismatch):
+		writeError(w, http.StatusPreconditionFailed, CodePrecondition, capitalize(err.Error()))
+	case errors.Is(err, repository.ErrQueryTooExpensive), errors.Is(err, service.ErrInvalidSnapshot),
+		errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidInclude),
+		errors.Is(err, service.ErrInvalidVerificationToken), errors.Is(err, service.ErrInvalidDeliveryStatus),
+		errors.Is(err, service.ErrInvalidSearch), errors.Is(err, service.ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, CodeBadRequest, capitalize(err.Error()))
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidRefreshToken):
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, capitalize(err.Error()))
+	case errors.Is(r.Context().Err(), context.Canceled):
+		// Клиент отключился, запрос к базе прерван — отвечать уже некому
+		slog.InfoContext(r.Context(), "Request canceled", "err", err)
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		slog.WarnContext(r.Context(), "Request timed out", "err", err)
+		writeError(w, http.StatusGatewayTimeout, CodeTimeout, "Request took too long and was aborted")
+	case h.cfg.RetryAfterSeconds > 0 && repository.IsTransient(err):
+		slog.WarnContext(r.Context(), "Transient database error", "err", err)
+		w.Header().Set("Retry-After", strconv.Itoa(h.cfg.RetryAfterSeconds))
+		writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "Database temporarily unavailable")
+	default:
+		writeInternalError(w, r, err)
+	}
+}
+
+// writeInternalError функция для ответа 500 без раскрытия деталей ошибки
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "Internal error", "err", err)
+	writeError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// capitalize функция для приведения текста ошибки к виду сообщения API
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
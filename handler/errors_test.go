@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"laba8/config"
+	"laba8/model"
+)
+
+func TestTransientErrorsDowngradeTo503(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter int
+		err        error
+		status     int
+		code       string
+	}{
+		{"transient with retry", 7, io.ErrUnexpectedEOF, http.StatusServiceUnavailable, CodeUnavailable},
+		{"transient with retry disabled", 0, io.ErrUnexpectedEOF, http.StatusInternalServerError, CodeInternal},
+		{"permanent error", 7, errors.New("column does not exist"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.RetryAfterSeconds = tt.retryAfter })
+			env.users.err = tt.err
+			rec := env.call("GET", "/users/1", env.token(t, model.RoleViewer), "")
+			checkError(t, rec, tt.status, tt.code)
+
+			wantRetry := ""
+			if tt.status == http.StatusServiceUnavailable {
+				wantRetry = "7"
+			}
+			if got := rec.Header().Get("Retry-After"); got != wantRetry {
+				t.Fatalf("Retry-After = %q, want %q", got, wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"laba8/events"
+)
+
+// eventsHeartbeat как часто в поток событий пишется комментарий, чтобы прокси не закрывали простаивающее соединение
+const eventsHeartbeat = 25 * time.Second
+
+// streamEvents функция для трансляции событий об изменениях пользователей в формате Server-Sent Events.
+// Клиент, переподключаясь с заголовком Last-Event-ID, получает сохранённые события, которые пропустил
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Last-Event-ID must be an event id")
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток длится дольше WRITE_TIMEOUT сервера, поэтому срок записи для этого соединения снимается
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear write deadline for event stream", "err", err)
+	}
+
+	// Подписчик получает события только своей организации
+	claims, _ := claimsFromContext(r.Context())
+	sub, missed := h.events.Subscribe(claims.Tenant(), lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Клиенту EventSource подсказывается задержка переподключения
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Подписчик не успевал читать и был отключён; клиент переподключится с Last-Event-ID
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent функция для записи события в поток SSE
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
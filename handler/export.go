@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"laba8/model"
+)
+
+// exportUsers функция для потоковой выгрузки пользователей в CSV или NDJSON с теми же фильтрами, что и GET /users.
+// Строки пишутся и сбрасываются клиенту порциями по мере чтения из базы
+func (h *Handler) exportUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameter format must be csv or ndjson")
+		return
+	}
+	params, err := listParams(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	var ok bool
+	if params.IncludeDeleted, ok = includeDeleted(w, r); !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Большая выгрузка идёт дольше WRITE_TIMEOUT сервера, поэтому срок записи снимается, как для /events
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear write deadline for export", "err", err)
+	}
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	// Заголовки отправляются с первой порцией, чтобы ошибку до начала выгрузки можно было вернуть обычным ответом
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().UTC().Format("20060102-150405"), format))
+		if format == "csv" {
+			csvWriter.Write([]string{"id", "name", "email", "age"})
+		}
+	}
+
+	err = h.users.Export(r.Context(), params, func(batch []model.User) error {
+		if !started {
+			start()
+		}
+		for _, user := range batch {
+			if format == "csv" {
+				csvWriter.Write([]string{strconv.Itoa(user.ID), user.Name, user.Email, strconv.Itoa(user.Age)})
+			} else if err := encoder.Encode(user); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil && !started {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if err != nil {
+		// Часть файла уже отправлена: обрываем соединение, чтобы клиент не принял неполную выгрузку за целую
+		slog.ErrorContext(r.Context(), "Export aborted after partial write", "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	if !started {
+		// Пустая выгрузка: только заголовок CSV или пустое тело NDJSON
+		start()
+		csvWriter.Flush()
+	}
+}
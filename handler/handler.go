@@ -0,0 +1,172 @@
+// Package handler содержит HTTP-обработчики, middleware и маршрутизацию API.
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"laba8/config"
+	"laba8/events"
+	"laba8/metrics"
+	"laba8/model"
+	"laba8/ratelimit"
+	"laba8/service"
+)
+
+// Pinger интерфейс проверки доступности базы данных
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// BuildInfo структура для хранения сведений о сборке, которые отдаёт /version
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Deps структура зависимостей HTTP-слоя
+type Deps struct {
+	Users    *service.UserService
+	Profiles *service.ProfileService
+	Avatars  *service.AvatarService
+	// Verification отправляет письма подтверждения email новым пользователям
+	Verification *service.VerificationService
+	Passwords    *service.PasswordResetService
+	Webhooks     *service.WebhookService
+	Jobs         *service.JobRunner
+	Tenants      *service.TenantService
+	Auth         *service.AuthService
+	DB           Pinger
+	Build        BuildInfo
+	Metrics      *metrics.Metrics
+	// Events шина событий об изменениях пользователей для GET /events, nil — события не публикуются
+	Events *events.Hub
+	// Limiter ограничитель частоты запросов, nil — без ограничения
+	Limiter ratelimit.Limiter
+}
+
+// Handler структура HTTP-слоя: обработчики работают только через сервисы
+type Handler struct {
+	cfg          *config.Config
+	users        *service.UserService
+	profiles     *service.ProfileService
+	avatars      *service.AvatarService
+	verification *service.VerificationService
+	passwords    *service.PasswordResetService
+	webhooks     *service.WebhookService
+	jobs         *service.JobRunner
+	tenants      *service.TenantService
+	auth         *service.AuthService
+	db           Pinger
+	build        BuildInfo
+	metrics      *metrics.Metrics
+	limiter      ratelimit.Limiter
+	events       *events.Hub
+}
+
+// New функция для создания HTTP-слоя
+func New(cfg *config.Config, deps Deps) *Handler {
+	h := &Handler{
+		cfg:          cfg,
+		users:        deps.Users,
+		profiles:     deps.Profiles,
+		avatars:      deps.Avatars,
+		verification: deps.Verification,
+		passwords:    deps.Passwords,
+		webhooks:     deps.Webhooks,
+		jobs:         deps.Jobs,
+		tenants:      deps.Tenants,
+		auth:         deps.Auth,
+		db:           deps.DB,
+		build:        deps.Build,
+		metrics:      deps.Metrics,
+		limiter:      deps.Limiter,
+		events:       deps.Events,
+	}
+	// Отчёт асинхронного импорта совпадает с ответом синхронного, поэтому задачу выполняет HTTP-слой
+	h.jobs.Register(service.JobImportUsers, h.runImportJob)
+	return h
+}
+
+// Routes функция для построения маршрутизатора со всеми маршрутами и middleware
+func (h *Handler) Routes() http.Handler {
+	router := mux.NewRouter()
+	router.Use(h.metricsMiddleware)
+
+	// Служебные маршруты для оркестратора
+	router.HandleFunc("/healthz", h.healthz).Methods("GET")
+	router.HandleFunc("/readyz", h.readyz).Methods("GET")
+	router.HandleFunc("/version", h.versionHandler).Methods("GET")
+	router.Handle("/metrics", h.metrics.Handler()).Methods("GET")
+	// Документация API: спецификация и Swagger UI
+	router.HandleFunc("/openapi.json", h.openAPIHandler).Methods("GET")
+	router.HandleFunc("/docs", h.docsHandler).Methods("GET")
+
+	// Маршруты
+	router.HandleFunc("/register", h.registerHandler).Methods("POST")
+	router.HandleFunc("/login", h.loginHandler).Methods("POST")
+	// Ссылка из письма открывается без токена, поэтому маршрут вне защищённого /users
+	router.HandleFunc("/users/verify", h.verifyEmail).Methods("GET")
+	router.HandleFunc("/auth/refresh", h.refreshHandler).Methods("POST")
+	router.HandleFunc("/auth/forgot-password", h.forgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/auth/reset-password", h.resetPasswordHandler).Methods("POST")
+	router.Handle("/auth/logout", h.authMiddleware(http.HandlerFunc(h.logoutHandler))).Methods("POST")
+
+	// Маршруты пользователей доступны только с действительным токеном
+	users := router.PathPrefix("/users").Subrouter()
+	users.Use(h.authMiddleware)
+	readers := requireRole(model.RoleAdmin, model.RoleEditor, model.RoleViewer)
+	writers := requireRole(model.RoleAdmin, model.RoleEditor)
+	admins := requireRole(model.RoleAdmin)
+	users.Handle("", readers(http.HandlerFunc(h.getUsers))).Methods("GET")
+	users.Handle("/export", readers(http.HandlerFunc(h.exportUsers))).Methods("GET")
+	users.Handle("/search", readers(http.HandlerFunc(h.searchUsers))).Methods("GET")
+	users.Handle("/{id}", readers(http.HandlerFunc(h.getUser))).Methods("GET")
+	users.Handle("", writers(http.HandlerFunc(h.createUser))).Methods("POST")
+	users.Handle("/bulk", writers(http.HandlerFunc(h.bulkCreateUsers))).Methods("POST")
+	users.Handle("/{id}", writers(http.HandlerFunc(h.updateUser))).Methods("PUT")
+	users.Handle("/{id}", writers(http.HandlerFunc(h.patchUser))).Methods("PATCH")
+	users.Handle("/{id}", admins(http.HandlerFunc(h.deleteUser))).Methods("DELETE")
+	users.Handle("/{id}/profile", readers(http.HandlerFunc(h.getProfile))).Methods("GET")
+	users.Handle("/{id}/profile", writers(http.HandlerFunc(h.saveProfile))).Methods("PUT")
+	users.Handle("/{id}/avatar", readers(http.HandlerFunc(h.getAvatar))).Methods("GET")
+	users.Handle("/{id}/avatar", writers(http.HandlerFunc(h.uploadAvatar))).Methods("POST")
+	users.Handle("/{id}/verification", writers(http.HandlerFunc(h.resendVerification))).Methods("POST")
+	users.Handle("/{id}/audit", admins(http.HandlerFunc(h.getUserAudit))).Methods("GET")
+	users.Handle("/{id}/restore", admins(http.HandlerFunc(h.restoreUser))).Methods("POST")
+
+	// Состояние фоновых задач, например асинхронного импорта
+	router.Handle("/jobs/{id}", h.authMiddleware(readers(http.HandlerFunc(h.getJob)))).Methods("GET")
+
+	// Поток событий об изменениях пользователей для других сервисов
+	if h.events != nil {
+		router.Handle("/events", h.authMiddleware(readers(http.HandlerFunc(h.streamEvents)))).Methods("GET")
+	}
+
+	// Администрирование учётных записей
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(h.authMiddleware, admins)
+	admin.HandleFunc("/accounts/{id}/role", h.assignRoleHandler).Methods("PUT")
+	admin.HandleFunc("/invites", h.createInviteHandler).Methods("POST")
+	admin.HandleFunc("/login-audits", h.loginAuditsHandler).Methods("GET")
+
+	// Подписки webhook на события пользователей управляются администратором
+	webhooks := router.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(h.authMiddleware, admins)
+	webhooks.HandleFunc("", h.listWebhooks).Methods("GET")
+	webhooks.HandleFunc("", h.createWebhook).Methods("POST")
+	webhooks.HandleFunc("/{id}", h.getWebhook).Methods("GET")
+	webhooks.HandleFunc("/{id}", h.updateWebhook).Methods("PUT")
+	webhooks.HandleFunc("/{id}", h.deleteWebhook).Methods("DELETE")
+	webhooks.HandleFunc("/{id}/deliveries", h.getWebhookDeliveries).Methods("GET")
+
+	checkOpenAPI(router)
+
+	// Снаружи внутрь: ID запроса, логирование, перехват паник, CORS, проверка длины URL, ограничение частоты,
+	// таймаут запроса, выбор организации. CORS снаружи лимита, чтобы и ответ 429 был виден браузерному приложению
+	return requestIDMiddleware(h.loggingMiddleware(recoveryMiddleware(h.corsMiddleware(h.urlLengthMiddleware(h.rateLimitMiddleware(h.timeoutMiddleware(h.tenantMiddleware(router))))))))
+}
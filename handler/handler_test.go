@@ -0,0 +1,901 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"laba8/config"
+	"laba8/events"
+	"laba8/mailer"
+	"laba8/metrics"
+	"laba8/model"
+	"laba8/ratelimit"
+	"laba8/repository"
+	"laba8/service"
+	"laba8/storage"
+)
+
+// testSecret ключ подписи токенов в тестах HTTP-слоя
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	// Каждый запрос пишется в лог; в выводе тестов он только мешает
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testEnv структура HTTP-слоя поверх настоящих сервисов и хранилищ в памяти
+type testEnv struct {
+	handler  http.Handler
+	cfg      *config.Config
+	users    *memUsers
+	profiles *memProfiles
+	accounts *memAccounts
+	tokens   *memTokens
+	invites  *memInvites
+	jobs     *memJobs
+	webhooks *memWebhooks
+	db       *fakePinger
+	hub      *events.Hub
+	nextJTI  int
+}
+
+// newTestEnv функция для сборки HTTP-слоя для теста; configure может изменить настройки и зависимости
+func newTestEnv(t *testing.T, configure ...func(*config.Config, *Deps)) *testEnv {
+	t.Helper()
+	cfg := config.Default()
+	cfg.JWTSecret = testSecret
+	cfg.StorageDir = t.TempDir()
+
+	files, err := storage.NewLocal(cfg.StorageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{
+		cfg:      &cfg,
+		users:    newMemUsers(),
+		profiles: &memProfiles{byUser: map[int]*model.Profile{}},
+		accounts: newMemAccounts(t),
+		tokens:   &memTokens{refresh: map[string]*model.RefreshToken{}, revoked: map[string]bool{}},
+		jobs:     &memJobs{byID: map[int]*model.Job{}},
+		webhooks: &memWebhooks{byID: map[int]*model.Webhook{}},
+		db:       &fakePinger{},
+		hub:      events.NewHub(cfg.EventsHistory),
+	}
+	env.invites = &memInvites{byHash: map[string]*model.Invite{}, accounts: env.accounts}
+	validate := service.NewValidator()
+	jobs := service.NewJobRunner(env.jobs, service.JobOptions{Workers: 1, MaxAttempts: 3, BaseBackoff: time.Second, Timeout: time.Minute})
+	auth := service.NewAuthService(env.accounts, &memLoginAudits{}, env.tokens, env.invites, validate,
+		testSecret, time.Minute, time.Hour, time.Hour)
+	deps := Deps{
+		Users:        service.NewUserService(env.users, memAudits{}, validate, service.UserOptions{}),
+		Profiles:     service.NewProfileService(env.profiles, validate),
+		Avatars:      service.NewAvatarService(env.users, env.profiles, files, cfg.AvatarThumbSize),
+		Verification: service.NewVerificationService(env.users, mailer.Log{}, jobs, testSecret, time.Hour, cfg.PublicURL),
+		Passwords:    service.NewPasswordResetService(env.accounts, memResets{}, mailer.Log{}, jobs, validate, time.Hour),
+		Webhooks:     service.NewWebhookService(env.webhooks, validate, service.WebhookOptions{Timeout: time.Second, MaxAttempts: 3, BaseBackoff: time.Second}),
+		Jobs:         jobs,
+		Tenants:      service.NewTenantService(memTenants{}, validate),
+		Auth:         auth,
+		DB:           env.db,
+		Build:        BuildInfo{Version: "test"},
+		Metrics:      metrics.New(),
+		Events:       env.hub,
+	}
+	for _, fn := range configure {
+		fn(env.cfg, &deps)
+	}
+	env.handler = New(env.cfg, deps).Routes()
+	return env
+}
+
+// Учётные записи, для которых выдаются токены в тестах; все в организации по умолчанию
+var testAccounts = map[string]int{
+	model.RoleAdmin:   1,
+	model.RoleEditor:  2,
+	model.RoleViewer:  3,
+	model.RolePending: 4,
+}
+
+// token функция для выдачи access-токена учётной записи с ролью role
+func (e *testEnv) token(t *testing.T, role string) string {
+	t.Helper()
+	e.nextJTI++
+	now := time.Now()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, service.Claims{
+		AccountID: testAccounts[role],
+		Username:  role,
+		Role:      role,
+		TenantID:  model.DefaultTenantID,
+		SessionID: "session-" + role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fmt.Sprintf("jti-%d", e.nextJTI),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// newRequest функция для создания запроса; непустое тело отправляется как JSON, пустой token — без авторизации
+func newRequest(method, path, token, body string) *http.Request {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// serve функция для выполнения запроса через все маршруты и middleware
+func (e *testEnv) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// call функция для выполнения запроса с токеном и JSON-телом
+func (e *testEnv) call(method, path, token, body string) *httptest.ResponseRecorder {
+	return e.serve(newRequest(method, path, token, body))
+}
+
+// checkStatus функция для проверки кода ответа
+func checkStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// checkError функция для проверки ответа с ошибкой: код ответа, JSON-конверт и код ошибки
+func checkError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) APIError {
+	t.Helper()
+	checkStatus(t, rec, status)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var resp errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error body %q: %v", rec.Body, err)
+	}
+	if resp.Error.Code != code || resp.Error.Message == "" {
+		t.Fatalf("error = %+v, want code %q with a message", resp.Error, code)
+	}
+	return resp.Error
+}
+
+// decodeBody функция для разбора JSON-ответа в dst
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body, err)
+	}
+}
+
+// fakePinger проверка доступности базы, которая отвечает ошибкой err
+type fakePinger struct {
+	err error
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error { return p.err }
+
+// memUsers хранилище пользователей в памяти; err, если задана, возвращается из каждого метода
+type memUsers struct {
+	mu     sync.Mutex
+	byID   map[int]*model.User
+	nextID int
+	err    error
+}
+
+func newMemUsers() *memUsers {
+	return &memUsers{byID: map[int]*model.User{}}
+}
+
+// add функция для добавления пользователя в обход сервиса
+func (m *memUsers) add(name, email string, age int) *model.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	user := &model.User{ID: m.nextID, TenantID: model.DefaultTenantID, Name: name, Email: email, Age: age, Version: 1}
+	m.byID[user.ID] = user
+	return user
+}
+
+// match функция для отбора живых пользователей под фильтр по порядку id
+func (m *memUsers) match(filter repository.UserFilter) []model.User {
+	var users []model.User
+	for _, user := range m.byID {
+		if user.DeletedAt != nil && !filter.IncludeDeleted {
+			continue
+		}
+		if filter.Name != "" && user.Name != filter.Name {
+			continue
+		}
+		if filter.MaxID != nil && user.ID > *filter.MaxID {
+			continue
+		}
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func (m *memUsers) List(ctx context.Context, filter repository.UserFilter) ([]model.User, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+	users := m.match(filter)
+	total := len(users)
+	users = users[min(filter.Offset, total):min(filter.Offset+filter.Limit, total)]
+	return users, total, nil
+}
+
+func (m *memUsers) Each(ctx context.Context, filter repository.UserFilter, batchSize int, fn func([]model.User) error) error {
+	m.mu.Lock()
+	users := m.match(filter)
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for len(users) > 0 {
+		n := min(batchSize, len(users))
+		if err := fn(users[:n]); err != nil {
+			return err
+		}
+		users = users[n:]
+	}
+	return nil
+}
+
+func (m *memUsers) ListAfter(ctx context.Context, filter repository.UserFilter) ([]model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	all := m.match(filter)
+	desc := len(filter.Sort) == 1 && filter.Sort[0].Desc
+	if desc {
+		sort.Slice(all, func(i, j int) bool { return all[i].ID > all[j].ID })
+	}
+	var users []model.User
+	for _, user := range all {
+		if filter.AfterID != nil && ((!desc && user.ID <= *filter.AfterID) || (desc && user.ID >= *filter.AfterID)) {
+			continue
+		}
+		if len(users) == filter.Limit {
+			break
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (m *memUsers) MaxID(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.nextID, m.err
+}
+
+func (m *memUsers) Get(ctx context.Context, id int, opts repository.GetOptions) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	user, ok := m.byID[id]
+	if !ok || (user.DeletedAt != nil && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("user %w", repository.ErrNotFound)
+	}
+	found := *user
+	return &found, nil
+}
+
+// emailTaken функция для проверки, занят ли email другим живым пользователем
+func (m *memUsers) emailTaken(email string, except int) bool {
+	for _, user := range m.byID {
+		if user.ID != except && user.DeletedAt == nil && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memUsers) Create(ctx context.Context, user *model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	if m.emailTaken(user.Email, 0) {
+		return fmt.Errorf("user with this email %w", repository.ErrConflict)
+	}
+	m.nextID++
+	user.ID, user.TenantID, user.Version = m.nextID, model.DefaultTenantID, 1
+	stored := *user
+	m.byID[user.ID] = &stored
+	return nil
+}
+
+func (m *memUsers) CreateMany(ctx context.Context, users []*model.User, atomic bool) ([]error, error) {
+	rowErrs := make([]error, len(users))
+	for i, user := range users {
+		rowErrs[i] = m.Create(ctx, user)
+	}
+	return rowErrs, nil
+}
+
+// checkVersion функция для проверки ожидаемой версии пользователя
+func checkVersion(user *model.User, version int) error {
+	if version != 0 && user.Version != version {
+		return fmt.Errorf("user has version %d, not %d: %w", user.Version, version, repository.ErrVersionMismatch)
+	}
+	return nil
+}
+
+func (m *memUsers) Update(ctx context.Context, user *model.User, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	current, ok := m.byID[user.ID]
+	if !ok || current.DeletedAt != nil {
+		return fmt.Errorf("user %w", repository.ErrNotFound)
+	}
+	if err := checkVersion(current, version); err != nil {
+		return err
+	}
+	user.TenantID, user.Version = current.TenantID, current.Version+1
+	stored := *user
+	m.byID[user.ID] = &stored
+	return nil
+}
+
+func (m *memUsers) Patch(ctx context.Context, id int, patch model.UserPatch, version int) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	current, ok := m.byID[id]
+	if !ok || current.DeletedAt != nil {
+		return nil, fmt.Errorf("user %w", repository.ErrNotFound)
+	}
+	if err := checkVersion(current, version); err != nil {
+		return nil, err
+	}
+	if len(patch.Apply(current)) > 0 {
+		current.Version++
+	}
+	patched := *current
+	return &patched, nil
+}
+
+func (m *memUsers) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	// Как и в Postgres, удаление отсутствующего или уже удалённого пользователя ошибкой не считается
+	user, ok := m.byID[id]
+	if !ok || user.DeletedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	return nil
+}
+
+func (m *memUsers) Restore(ctx context.Context, id int) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	user, ok := m.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("user %w", repository.ErrNotFound)
+	}
+	if user.DeletedAt == nil {
+		return nil, fmt.Errorf("user is not deleted: %w", repository.ErrConflict)
+	}
+	user.DeletedAt = nil
+	user.Version++
+	restored := *user
+	return &restored, nil
+}
+
+func (m *memUsers) MarkVerified(ctx context.Context, id int, email string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.byID[id]
+	if !ok || user.DeletedAt != nil || !strings.EqualFold(user.Email, email) {
+		return nil, fmt.Errorf("user %w", repository.ErrNotFound)
+	}
+	user.Verified = true
+	verified := *user
+	return &verified, nil
+}
+
+func (m *memUsers) Search(ctx context.Context, filter repository.SearchFilter) ([]model.UserSearchHit, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+	var hits []model.UserSearchHit
+	for _, user := range m.match(repository.UserFilter{IncludeDeleted: filter.IncludeDeleted}) {
+		hits = append(hits, model.UserSearchHit{User: user, Rank: 1, Highlight: map[string]string{"name": user.Name}})
+	}
+	return hits, len(hits), nil
+}
+
+// memAudits журнал изменений без записей
+type memAudits struct{}
+
+func (memAudits) ListByEntity(ctx context.Context, id int, entities ...string) ([]model.AuditLog, error) {
+	return nil, nil
+}
+
+// memProfiles профили пользователей в памяти
+type memProfiles struct {
+	mu     sync.Mutex
+	byUser map[int]*model.Profile
+}
+
+func (m *memProfiles) Get(ctx context.Context, userID int) (*model.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile, ok := m.byUser[userID]
+	if !ok {
+		return nil, fmt.Errorf("profile %w", repository.ErrNotFound)
+	}
+	found := *profile
+	return &found, nil
+}
+
+func (m *memProfiles) Save(ctx context.Context, profile *model.Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *profile
+	m.byUser[profile.UserID] = &stored
+	return nil
+}
+
+func (m *memProfiles) SetAvatar(ctx context.Context, userID int, url string) (*model.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile, ok := m.byUser[userID]
+	if !ok {
+		profile = &model.Profile{UserID: userID}
+		m.byUser[userID] = profile
+	}
+	profile.AvatarURL = url
+	updated := *profile
+	return &updated, nil
+}
+
+// memAccounts учётные записи в памяти с паролем secret123; по одной на каждую роль из testAccounts
+type memAccounts struct {
+	mu   sync.Mutex
+	byID map[int]*model.Account
+}
+
+func newMemAccounts(t *testing.T) *memAccounts {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &memAccounts{byID: map[int]*model.Account{}}
+	for role, id := range testAccounts {
+		m.byID[id] = &model.Account{ID: id, TenantID: model.DefaultTenantID, Username: role,
+			Email: role + "@example.com", PasswordHash: string(hash), Role: role}
+	}
+	return m
+}
+
+func (m *memAccounts) Create(ctx context.Context, account *model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account.ID = len(m.byID) + 1
+	m.byID[account.ID] = account
+	return nil
+}
+
+func (m *memAccounts) Get(ctx context.Context, id int) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if account, ok := m.byID[id]; ok {
+		return account, nil
+	}
+	return nil, fmt.Errorf("account %w", repository.ErrNotFound)
+}
+
+func (m *memAccounts) GetByUsername(ctx context.Context, username string) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, account := range m.byID {
+		if account.Username == username {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("account %w", repository.ErrNotFound)
+}
+
+func (m *memAccounts) GetByEmail(ctx context.Context, email string) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, account := range m.byID {
+		if strings.EqualFold(account.Email, email) {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("account %w", repository.ErrNotFound)
+}
+
+func (m *memAccounts) UpdateRole(ctx context.Context, id int, role string) (*model.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account, ok := m.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("account %w", repository.ErrNotFound)
+	}
+	account.Role = role
+	return account, nil
+}
+
+func (m *memAccounts) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if account, ok := m.byID[id]; ok {
+		account.PasswordHash = passwordHash
+		return nil
+	}
+	return fmt.Errorf("account %w", repository.ErrNotFound)
+}
+
+// memLoginAudits журнал попыток входа в памяти
+type memLoginAudits struct {
+	mu      sync.Mutex
+	records []model.LoginAudit
+}
+
+func (m *memLoginAudits) Record(ctx context.Context, audit *model.LoginAudit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, *audit)
+	return nil
+}
+
+func (m *memLoginAudits) List(ctx context.Context, filter repository.LoginAuditFilter) ([]model.LoginAudit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.LoginAudit(nil), m.records...), nil
+}
+
+// memTokens refresh-токены и отозванные access-токены в памяти
+type memTokens struct {
+	mu      sync.Mutex
+	refresh map[string]*model.RefreshToken
+	revoked map[string]bool
+	// err, если задана, возвращается из проверки отзыва access-токена
+	err error
+}
+
+func (m *memTokens) CreateRefresh(ctx context.Context, token *model.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token.ID = len(m.refresh) + 1
+	m.refresh[token.TokenHash] = token
+	return nil
+}
+
+func (m *memTokens) GetRefreshByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if token, ok := m.refresh[hash]; ok {
+		found := *token
+		return &found, nil
+	}
+	return nil, fmt.Errorf("refresh token %w", repository.ErrNotFound)
+}
+
+func (m *memTokens) RevokeRefresh(ctx context.Context, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.refresh {
+		if token.ID == id && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memTokens) RevokeSession(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, token := range m.refresh {
+		if token.SessionID == sessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memTokens) RevokeAccess(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = true
+	return nil
+}
+
+func (m *memTokens) IsAccessRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revoked[jti], m.err
+}
+
+// memInvites приглашения в памяти; Redeem создаёт учётную запись в accounts
+type memInvites struct {
+	mu       sync.Mutex
+	byHash   map[string]*model.Invite
+	accounts *memAccounts
+}
+
+func (m *memInvites) Create(ctx context.Context, invite *model.Invite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invite.ID = len(m.byHash) + 1
+	invite.TenantID = model.DefaultTenantID
+	m.byHash[invite.TokenHash] = invite
+	return nil
+}
+
+func (m *memInvites) Redeem(ctx context.Context, tokenHash string, account *model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invite, ok := m.byHash[tokenHash]
+	if !ok || invite.UsedAt != nil || time.Now().After(invite.ExpiresAt) {
+		return repository.ErrInviteInvalid
+	}
+	if _, err := m.accounts.GetByUsername(ctx, account.Username); err == nil {
+		return fmt.Errorf("username or email %w", repository.ErrConflict)
+	}
+	now := time.Now()
+	invite.UsedAt = &now
+	account.TenantID, account.Role = invite.TenantID, invite.Role
+	return m.accounts.Create(ctx, account)
+}
+
+// memResets токены сброса пароля: ни один токен не действителен
+type memResets struct{}
+
+func (memResets) Create(ctx context.Context, token *model.ResetToken) error { return nil }
+
+func (memResets) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	return 0, repository.ErrResetTokenInvalid
+}
+
+// memJobs очередь задач в памяти; задачи не выполняются, фоновый обработчик в тестах не запускается
+type memJobs struct {
+	mu   sync.Mutex
+	byID map[int]*model.Job
+}
+
+func (m *memJobs) Create(ctx context.Context, job *model.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.ID = len(m.byID) + 1
+	job.Status = model.JobQueued
+	stored := *job
+	m.byID[job.ID] = &stored
+	return nil
+}
+
+func (m *memJobs) Get(ctx context.Context, id int) (*model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.byID[id]; ok {
+		found := *job
+		return &found, nil
+	}
+	return nil, fmt.Errorf("job %w", repository.ErrNotFound)
+}
+
+func (m *memJobs) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.Job, error) {
+	return nil, nil
+}
+
+func (m *memJobs) Record(ctx context.Context, job *model.Job) error { return nil }
+
+func (m *memJobs) Purge(ctx context.Context, before time.Time) (int, error) { return 0, nil }
+
+// memWebhooks подписки webhook в памяти без доставок
+type memWebhooks struct {
+	mu   sync.Mutex
+	byID map[int]*model.Webhook
+	next int
+}
+
+func (m *memWebhooks) Create(ctx context.Context, hook *model.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	hook.ID = m.next
+	stored := *hook
+	m.byID[hook.ID] = &stored
+	return nil
+}
+
+func (m *memWebhooks) Get(ctx context.Context, id int) (*model.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hook, ok := m.byID[id]; ok {
+		found := *hook
+		return &found, nil
+	}
+	return nil, fmt.Errorf("webhook %w", repository.ErrNotFound)
+}
+
+func (m *memWebhooks) List(ctx context.Context) ([]model.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var hooks []model.Webhook
+	for _, hook := range m.byID {
+		hooks = append(hooks, *hook)
+	}
+	return hooks, nil
+}
+
+func (m *memWebhooks) Update(ctx context.Context, hook *model.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byID[hook.ID]; !ok {
+		return fmt.Errorf("webhook %w", repository.ErrNotFound)
+	}
+	stored := *hook
+	m.byID[hook.ID] = &stored
+	return nil
+}
+
+func (m *memWebhooks) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byID[id]; !ok {
+		return fmt.Errorf("webhook %w", repository.ErrNotFound)
+	}
+	delete(m.byID, id)
+	return nil
+}
+
+func (m *memWebhooks) Enqueue(ctx context.Context, eventType string, payload json.RawMessage) (int, error) {
+	return 0, nil
+}
+
+func (m *memWebhooks) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *memWebhooks) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return nil
+}
+
+func (m *memWebhooks) Deliveries(ctx context.Context, webhookID int, status string, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := m.Get(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// memTenants организации: кроме организации по умолчанию известна только acme
+type memTenants struct{}
+
+func (memTenants) Create(ctx context.Context, tenant *model.Tenant, admin *model.Account) error {
+	return nil
+}
+
+func (memTenants) Get(ctx context.Context, id int) (*model.Tenant, error) {
+	return nil, fmt.Errorf("tenant %w", repository.ErrNotFound)
+}
+
+func (memTenants) GetBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
+	switch slug {
+	case "default":
+		return &model.Tenant{ID: model.DefaultTenantID, Slug: slug, Name: "Default"}, nil
+	case "acme":
+		return &model.Tenant{ID: 2, Slug: slug, Name: "Acme"}, nil
+	}
+	return nil, fmt.Errorf("tenant %w", repository.ErrNotFound)
+}
+
+func (memTenants) List(ctx context.Context) ([]model.Tenant, error) {
+	return nil, nil
+}
+
+func TestServiceRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	for _, path := range []string{"/healthz", "/readyz", "/version", "/metrics", "/openapi.json", "/docs"} {
+		if rec := env.call("GET", path, "", ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", path, rec.Code)
+		}
+	}
+
+	env.db.err = fmt.Errorf("connection refused")
+	rec := env.call("GET", "/readyz", "", "")
+	checkStatus(t, rec, http.StatusServiceUnavailable)
+	var body map[string]string
+	decodeBody(t, rec, &body)
+	if body["database"] != "unreachable" {
+		t.Fatalf("readyz body = %v, want database unreachable", body)
+	}
+	// Живость процесса от базы не зависит
+	checkStatus(t, env.call("GET", "/healthz", "", ""), http.StatusOK)
+}
+
+func TestUnknownRoute(t *testing.T) {
+	env := newTestEnv(t)
+	checkStatus(t, env.call("GET", "/nowhere", "", ""), http.StatusNotFound)
+}
+
+func TestRateLimit(t *testing.T) {
+	env := newTestEnv(t, func(_ *config.Config, deps *Deps) { deps.Limiter = ratelimit.NewMemory(1, 1) })
+
+	checkStatus(t, env.call("GET", "/version", "", ""), http.StatusOK)
+	rec := env.call("GET", "/version", "", "")
+	checkError(t, rec, http.StatusTooManyRequests, CodeRateLimited)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("429 without Retry-After")
+	}
+	// Лимит считается по учётной записи, а пробы оркестратора не ограничиваются
+	checkStatus(t, env.call("GET", "/users", env.token(t, model.RoleViewer), ""), http.StatusOK)
+	checkStatus(t, env.call("GET", "/healthz", "", ""), http.StatusOK)
+	checkStatus(t, env.call("GET", "/healthz", "", ""), http.StatusOK)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.CORS.AllowedOrigins = []string{"https://app.example.com"} })
+
+	req := httptest.NewRequest("OPTIONS", "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := env.serve(req)
+	checkStatus(t, rec, http.StatusNoContent)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatalf("Access-Control-Allow-Origin = %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	checkError(t, env.serve(req), http.StatusForbidden, CodeForbidden)
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// healthz функция для проверки, что процесс жив; зависимости не проверяются
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz функция для проверки готовности принимать трафик: база данных должна отвечать на ping
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(h.cfg.ReadyTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	if err := h.db.Ping(ctx); err != nil {
+		slog.WarnContext(r.Context(), "Readiness check failed", "err", err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "database": "unreachable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "database": "ok"})
+}
+
+// versionHandler функция для получения сведений о сборке
+func (h *Handler) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.build)
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"laba8/model"
+)
+
+// jobRetryAfter через сколько секунд клиенту стоит снова опросить незавершённую задачу
+const jobRetryAfter = "2"
+
+// getJob функция для получения состояния фоновой задачи. Чужие задачи видит только администратор,
+// для остальных они неотличимы от несуществующих
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	job, err := h.jobs.Get(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	claims, _ := claimsFromContext(r.Context())
+	if claims == nil || (claims.Role != model.RoleAdmin && (job.AccountID == nil || *job.AccountID != claims.AccountID)) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+	if job.Status == model.JobQueued || job.Status == model.JobRunning {
+		w.Header().Set("Retry-After", jobRetryAfter)
+	}
+	writeJSON(w, http.StatusOK, job)
+}
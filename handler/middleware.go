@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+	"laba8/service"
+)
+
+// contextKey тип ключей контекста запроса
+type contextKey string
+
+// claimsKey ключ, под которым в контексте хранятся данные токена
+const claimsKey contextKey = "claims"
+
+// requestIDHeader заголовок с ID запроса; переданный клиентом ID сохраняется
+const requestIDHeader = "X-Request-ID"
+
+// tenantKey ключ, под которым в контексте хранится организация из заголовка X-Tenant
+const tenantKey contextKey = "tenant"
+
+// tenantHeader заголовок со slug организации для запросов без токена, например регистрации
+const tenantHeader = "X-Tenant"
+
+// requestIDMiddleware функция для присвоения запросу ID и возврата его в ответе; ID попадает во все логи запроса
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// newRequestID функция для генерации случайного ID запроса
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder структура для запоминания кода ответа и числа записанных байт
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному ResponseWriter (Flush и т.п.)
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggingMiddleware функция для логирования каждого запроса: метод, путь, статус, время и ID запроса.
+// Ответы 5xx пишутся с уровнем error, остальные — info
+func (h *Handler) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "HTTP request",
+			"method", r.Method,
+			"url", h.truncateURL(r.URL.RequestURI()),
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// metricsMiddleware функция для учёта запроса в метриках по шаблону маршрута, чтобы ID в пути не плодили метки
+func (h *Handler) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		h.metrics.ObserveRequest(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+// timeoutMiddleware функция для ограничения времени обработки запроса: по истечении срока контекст отменяется,
+// и запросы к базе, выполняемые с контекстом запроса, прерываются. Поток /events и выгрузка /users/export
+// длительные и не ограничиваются
+func (h *Handler) timeoutMiddleware(next http.Handler) http.Handler {
+	if h.cfg.RequestTimeoutSeconds <= 0 {
+		return next
+	}
+	timeout := time.Duration(h.cfg.RequestTimeoutSeconds) * time.Second
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" || r.URL.Path == "/users/export" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recoveryMiddleware функция для перевода паники обработчика в ответ 500
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				// http.ErrAbortHandler используется для намеренного обрыва ответа
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				slog.ErrorContext(r.Context(), "Panic in HTTP handler",
+					"method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+				writeError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// claimsFromContext функция для получения данных токена из контекста запроса
+func claimsFromContext(ctx context.Context) (*service.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*service.Claims)
+	return claims, ok
+}
+
+// authMiddleware функция для защиты маршрутов: требует действительный Bearer-токен
+func (h *Handler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || tokenStr == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Missing bearer token")
+			return
+		}
+		claims, err := h.auth.VerifyToken(r.Context(), tokenStr)
+		if errors.Is(err, service.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid token")
+			return
+		}
+		if err != nil {
+			// Список отозванных токенов недоступен: пускать с непроверенным токеном нельзя
+			h.writeServiceError(w, r, err)
+			return
+		}
+		// Организация запроса с токеном — организация токена; X-Tenant может её только подтвердить
+		if headerTenant, ok := r.Context().Value(tenantKey).(int); ok && headerTenant != claims.Tenant() {
+			writeError(w, http.StatusForbidden, CodeForbidden, "Token belongs to another tenant")
+			return
+		}
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		ctx = repository.WithTenant(ctx, claims.Tenant())
+		ctx = logging.With(ctx, slog.Int("account_id", claims.AccountID), slog.Int("tenant_id", claims.Tenant()))
+		// Автор изменений для журнала, который хранилище пишет в одной транзакции с изменением
+		ctx = repository.WithActor(ctx, repository.Actor{
+			AccountID: claims.AccountID,
+			Username:  claims.Username,
+			RequestID: logging.RequestID(ctx),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantMiddleware функция для выбора организации запроса по заголовку X-Tenant, без него — организации
+// по умолчанию. Для запросов с токеном организацию затем задаёт authMiddleware
+func (h *Handler) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug := r.Header.Get(tenantHeader)
+		if slug == "" {
+			next.ServeHTTP(w, r.WithContext(repository.WithTenant(r.Context(), model.DefaultTenantID)))
+			return
+		}
+		tenantID, err := h.tenants.Resolve(r.Context(), slug)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Unknown tenant in X-Tenant header")
+			return
+		}
+		if err != nil {
+			h.writeServiceError(w, r, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey, tenantID)
+		next.ServeHTTP(w, r.WithContext(repository.WithTenant(ctx, tenantID)))
+	})
+}
+
+// requireRole функция для ограничения доступа к маршруту перечисленными ролями
+func requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := claimsFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+				return
+			}
+			for _, role := range roles {
+				if claims.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, http.StatusForbidden, CodeForbidden, "Insufficient role for this operation")
+		})
+	}
+}
+
+// rateLimitMiddleware функция для ограничения частоты запросов: с действительным токеном — по учётной записи,
+// иначе по IP клиента. Пробы /healthz и /readyz и сбор /metrics не ограничиваются
+func (h *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	if h.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, retryAfter, err := h.limiter.Allow(r.Context(), h.rateLimitKey(r))
+		if err != nil {
+			// Недоступность хранилища лимитов не должна останавливать API
+			slog.ErrorContext(r.Context(), "Rate limiter failed, request allowed", "err", err)
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey функция для выбора ключа лимита: учётная запись из действительного токена или IP клиента
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && tokenStr != "" {
+		if claims, err := h.auth.ParseToken(tokenStr); err == nil {
+			return "account:" + strconv.Itoa(claims.AccountID)
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// truncateURL функция для обрезки URL перед записью в лог
+func (h *Handler) truncateURL(url string) string {
+	if h.cfg.LogURLLength <= 0 || len(url) <= h.cfg.LogURLLength {
+		return url
+	}
+	return url[:h.cfg.LogURLLength] + "..."
+}
+
+// urlLengthMiddleware функция для отклонения запросов со слишком длинным URL
+func (h *Handler) urlLengthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.RequestURI()
+		if h.cfg.MaxURLLength > 0 && len(url) > h.cfg.MaxURLLength {
+			slog.WarnContext(r.Context(), "Rejected request with too long URL", "bytes", len(url), "method", r.Method, "url", h.truncateURL(url))
+			writeError(w, http.StatusRequestURITooLong, CodeURITooLong, "Request URI is too long")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
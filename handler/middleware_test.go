@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"laba8/config"
+	"laba8/model"
+)
+
+// captureLogs функция для записи логов теста в буфер; прежний логгер возвращается по завершении теста
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestURLTooLong(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) {
+		cfg.MaxURLLength = 64
+		cfg.LogURLLength = 32
+	})
+	logs := captureLogs(t)
+	viewer := env.token(t, model.RoleViewer)
+
+	long := "/users?name=" + strings.Repeat("x", 100)
+	checkError(t, env.call("GET", long, viewer, ""), http.StatusRequestURITooLong, CodeURITooLong)
+	checkStatus(t, env.call("GET", "/users?name=x", viewer, ""), http.StatusOK)
+
+	// В лог попадает только начало длинного URL
+	if strings.Contains(logs.String(), long) || !strings.Contains(logs.String(), long[:32]+"...") {
+		t.Fatalf("logs do not truncate the URL to 32 bytes:\n%s", logs)
+	}
+}
+
+func TestTruncateURL(t *testing.T) {
+	url := "/users?name=" + strings.Repeat("x", 20)
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{0, url},
+		{len(url), url},
+		{10, url[:10] + "..."},
+	}
+	for _, tt := range tests {
+		h := &Handler{cfg: &config.Config{LogURLLength: tt.limit}}
+		if got := h.truncateURL(url); got != tt.want {
+			t.Errorf("truncateURL with limit %d = %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"laba8/model"
+)
+
+// getProfile функция для получения профиля пользователя
+func (h *Handler) getProfile(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	profile, err := h.profiles.Get(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// saveProfile функция для создания или полной замены профиля пользователя
+func (h *Handler) saveProfile(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var profile model.Profile
+	if !h.decodeJSON(w, r, &profile) {
+		return
+	}
+	profile.UserID = id
+
+	if err := h.profiles.Save(r.Context(), &profile); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
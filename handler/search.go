@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"laba8/model"
+	"laba8/service"
+)
+
+// searchMaxLimit наибольший размер страницы поиска: подсветка считается для каждой строки страницы
+const searchMaxLimit = 100
+
+// searchResponse структура конверта ответа со страницей результатов поиска
+type searchResponse struct {
+	Data       []model.UserSearchHit `json:"data"`
+	Total      int                   `json:"total"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	TotalPages int                   `json:"total_pages"`
+}
+
+// searchUsers функция для полнотекстового поиска пользователей по имени и email (?q=...).
+// Результаты отсортированы по релевантности, совпадения подсвечены тегом <mark>
+func (h *Handler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameter q is required")
+		return
+	}
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > searchMaxLimit {
+		limit = searchMaxLimit
+	}
+
+	params := service.SearchParams{Query: q, Page: page, Limit: limit}
+	var ok bool
+	if params.IncludeDeleted, ok = includeDeleted(w, r); !ok {
+		return
+	}
+
+	result, err := h.users.Search(r.Context(), params)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+
+	resp := searchResponse{
+		Data:       result.Hits,
+		Total:      result.Total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (result.Total + limit - 1) / limit,
+	}
+	if resp.Data == nil {
+		resp.Data = []model.UserSearchHit{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,419 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"laba8/model"
+	"laba8/service"
+)
+
+// listResponse структура конверта ответа со страницей пользователей
+type listResponse struct {
+	Data       []model.User `json:"data"`
+	Total      int          `json:"total"`
+	Page       int          `json:"page"`
+	Limit      int          `json:"limit"`
+	TotalPages int          `json:"total_pages"`
+}
+
+// cursorListResponse структура конверта ответа keyset-пагинации (?cursor=); общего числа нет, чтобы не считать
+// всю выборку на каждой странице
+type cursorListResponse struct {
+	Data  []model.User `json:"data"`
+	Limit int          `json:"limit"`
+	// NextCursor значение cursor для следующей страницы, null на последней
+	NextCursor *string `json:"next_cursor"`
+}
+
+// maxUsersLimit наибольший размер страницы списка пользователей; больший limit уменьшается до него
+const maxUsersLimit = 100
+
+// getUsers функция для получения списка пользователей с поддержкой пагинации, фильтрации и сортировки.
+// С параметром cursor (пустым для первой страницы) страницы выбираются по id вместо page
+func (h *Handler) getUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageStr := query.Get("page")
+	limitStr := query.Get("limit")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	limit = min(limit, maxUsersLimit)
+
+	params, err := listParams(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	var ok bool
+	if params.IncludeDeleted, ok = includeDeleted(w, r); !ok {
+		return
+	}
+	params.Page = page
+	params.Limit = limit
+	params.Snapshot = query.Get("snapshot")
+
+	if query.Has("cursor") {
+		if pageStr != "" {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameters page and cursor cannot be combined")
+			return
+		}
+		h.getUsersByCursor(w, r, params, query.Get("cursor"))
+		return
+	}
+
+	result, err := h.users.List(r.Context(), params)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if result.SnapshotToken != "" {
+		w.Header().Set("X-Snapshot-Token", result.SnapshotToken)
+	}
+
+	resp := listResponse{
+		Data:       result.Users,
+		Total:      result.Total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (result.Total + limit - 1) / limit,
+	}
+	if resp.Data == nil {
+		resp.Data = []model.User{}
+	}
+	if link := paginationLinks(r, page, resp.TotalPages, result.SnapshotToken); link != "" {
+		w.Header().Set("Link", link)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// getUsersByCursor функция для ответа страницей keyset-пагинации; ссылка на следующую страницу — в заголовке Link
+func (h *Handler) getUsersByCursor(w http.ResponseWriter, r *http.Request, params service.ListParams, cursor string) {
+	result, err := h.users.ListCursor(r.Context(), params, cursor)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	resp := cursorListResponse{Data: result.Users, Limit: params.Limit}
+	if resp.Data == nil {
+		resp.Data = []model.User{}
+	}
+	if result.NextCursor != "" {
+		resp.NextCursor = &result.NextCursor
+		u := *r.URL
+		q := u.Query()
+		q.Set("cursor", result.NextCursor)
+		u.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), "next"))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listParams функция для чтения фильтров и сортировки списка, общих для GET /users и выгрузки
+func listParams(query url.Values) (service.ListParams, error) {
+	params := service.ListParams{
+		Name:     query.Get("name"),
+		NameLike: query.Get("name_like"),
+		// Сортировка: sort=name:asc,age:desc или несколько параметров sort
+		Sort: splitList(query["sort"]),
+	}
+	var err error
+	for name, dst := range map[string]**int{"age": &params.Age, "age_gte": &params.AgeGte, "age_lte": &params.AgeLte} {
+		if *dst, err = queryInt(query, name); err != nil {
+			return params, err
+		}
+	}
+	if v := query.Get("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			return params, fmt.Errorf("Parameter verified must be a boolean")
+		}
+		params.Verified = &verified
+	}
+	return params, nil
+}
+
+// paginationLinks функция для построения заголовка Link со ссылками на соседние страницы
+func paginationLinks(r *http.Request, page, totalPages int, snapshotToken string) string {
+	link := func(p int, rel string) string {
+		u := *r.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(p))
+		// Соседние страницы читаются из того же снимка
+		if snapshotToken != "" {
+			q.Set("snapshot", snapshotToken)
+		}
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+	}
+	var links []string
+	if page > 1 {
+		links = append(links, link(page-1, "prev"))
+	}
+	if page < totalPages {
+		links = append(links, link(page+1, "next"))
+	}
+	return strings.Join(links, ", ")
+}
+
+// queryInt функция для чтения необязательного целого параметра запроса
+func queryInt(query url.Values, name string) (*int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("Parameter %s must be an integer", name)
+	}
+	return &n, nil
+}
+
+// splitList функция для объединения повторяющихся параметров и значений через запятую в один список
+func splitList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// getUser функция для получения конкретного пользователя по ID
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+	include := splitList(r.URL.Query()["include"])
+	user, err := h.users.Get(r.Context(), id, service.GetParams{
+		IncludeDeleted: withDeleted,
+		// Связанные сущности: include=profile
+		Include: include,
+	})
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", userCacheControl)
+	// Версия меняется только с самим пользователем: профиль и отметка удаления в неё не входят,
+	// поэтому 304 отдаётся лишь для обычного чтения
+	if len(include) == 0 && !withDeleted && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// createUser функция для создания нового пользователя
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var user model.User
+	if !h.decodeJSON(w, r, &user) {
+		return
+	}
+
+	if err := h.users.Create(r.Context(), &user); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	h.verification.SendAsync(r.Context(), &user)
+	w.Header().Set("ETag", userETag(&user))
+	writeJSON(w, http.StatusOK, user)
+}
+
+// updateUser функция для обновления информации о пользователе
+func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	var user model.User
+	if !h.decodeJSON(w, r, &user) {
+		return
+	}
+
+	user.ID = id
+	var bodyVersion *int
+	if user.Version != 0 {
+		bodyVersion = &user.Version
+	}
+	version, ok := expectedVersion(w, r, bodyVersion)
+	if !ok {
+		return
+	}
+	if err := h.users.Update(r.Context(), &user, version); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", userETag(&user))
+	writeJSON(w, http.StatusOK, user)
+}
+
+// patchUser функция для частичного обновления пользователя: изменяются только переданные поля
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	var patch model.UserPatch
+	if !h.decodeJSON(w, r, &patch) {
+		return
+	}
+
+	version, ok := expectedVersion(w, r, patch.Version)
+	if !ok {
+		return
+	}
+	user, err := h.users.Patch(r.Context(), id, patch, version)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", userETag(user))
+	writeJSON(w, http.StatusOK, user)
+}
+
+// deleteUser функция для удаления пользователя
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	if err := h.users.Delete(r.Context(), id); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User deleted"})
+}
+
+// verifyEmail функция для подтверждения email по ссылке из письма; маршрут открыт, токен подписан сервером
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := h.verification.Verify(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Email verified", "user": user})
+}
+
+// resendVerification функция для постановки в очередь повторного письма подтверждения, например после смены email
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.verification.Resend(r.Context(), id); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Verification email queued"})
+}
+
+// restoreUser функция для восстановления мягко удалённого пользователя
+func (h *Handler) restoreUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	user, err := h.users.Restore(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", userETag(user))
+	writeJSON(w, http.StatusOK, user)
+}
+
+// userETag функция для построения ETag пользователя по номеру версии
+func userETag(user *model.User) string {
+	return fmt.Sprintf(`"v%d"`, user.Version)
+}
+
+// userCacheControl заголовок Cache-Control ответа с пользователем: ответ зависит от токена,
+// поэтому хранится только у клиента, и перед использованием перепроверяется по ETag
+const userCacheControl = "private, no-cache"
+
+// etagMatches функция для проверки If-None-Match: список тегов через запятую или *, сравнение слабое
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion функция для получения версии, которую клиент ожидает изменить: из If-Match
+// или, если заголовка нет, из поля version тела. If-Match: * отключает проверку (возвращается 0).
+// Без версии изменение отклоняется с 428; при ошибке ответ уже записан и второе значение false
+func expectedVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int) (int, bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case ifMatch == "*":
+		return 0, true
+	case ifMatch != "":
+		tag := strings.TrimPrefix(ifMatch, "W/")
+		version, err := strconv.Atoi(strings.TrimPrefix(strings.Trim(tag, `"`), "v"))
+		if err != nil || version < 1 {
+			// Чужой ETag не может совпасть с текущей версией
+			writeError(w, http.StatusPreconditionFailed, CodePrecondition, "If-Match does not match the current version")
+			return 0, false
+		}
+		return version, true
+	case bodyVersion != nil:
+		return *bodyVersion, true
+	default:
+		writeError(w, http.StatusPreconditionRequired, CodePreconditionReq,
+			"Send If-Match with the ETag from GET or a version field in the body")
+		return 0, false
+	}
+}
+
+// getUserAudit функция для получения журнала изменений пользователя
+func (h *Handler) getUserAudit(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, _ := strconv.Atoi(params["id"])
+
+	logs, err := h.users.History(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if logs == nil {
+		logs = []model.AuditLog{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": logs})
+}
+
+// includeDeleted функция для чтения параметра include_deleted; мягко удалённых видит только администратор.
+// При ошибке ответ уже записан и возвращается false во втором значении
+func includeDeleted(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("include_deleted")
+	if v == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Parameter include_deleted must be a boolean")
+		return false, false
+	}
+	if claims, _ := claimsFromContext(r.Context()); include && (claims == nil || claims.Role != model.RoleAdmin) {
+		writeError(w, http.StatusForbidden, CodeForbidden, "Only admins can include deleted users")
+		return false, false
+	}
+	return include, true
+}
@@ -0,0 +1,616 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"laba8/config"
+	"laba8/events"
+	"laba8/model"
+	"laba8/service"
+)
+
+func TestUsersRequireToken(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.call("GET", "/users", "", "")
+	checkError(t, rec, http.StatusUnauthorized, CodeUnauthorized)
+	if rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("WWW-Authenticate = %q, want Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	rec = env.call("GET", "/users", "not-a-jwt", "")
+	checkError(t, rec, http.StatusUnauthorized, CodeUnauthorized)
+	if !strings.Contains(rec.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Fatalf("WWW-Authenticate = %q, want invalid_token", rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestUsersRoleAccess(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	userPath := fmt.Sprintf("/users/%d", user.ID)
+
+	tests := []struct {
+		name         string
+		method, path string
+		role         string
+		body         string
+	}{
+		{"pending cannot read", "GET", "/users", model.RolePending, ""},
+		{"viewer cannot create", "POST", "/users", model.RoleViewer, `{"name":"Bob","email":"bob@example.com"}`},
+		{"viewer cannot update", "PUT", userPath, model.RoleViewer, `{"name":"Bob","email":"bob@example.com","version":1}`},
+		{"viewer cannot patch", "PATCH", userPath, model.RoleViewer, `{"age":31,"version":1}`},
+		{"viewer cannot import", "POST", "/users/bulk", model.RoleViewer, `[]`},
+		{"viewer cannot save profile", "PUT", userPath + "/profile", model.RoleViewer, `{"bio":"hi"}`},
+		{"viewer cannot resend verification", "POST", userPath + "/verification", model.RoleViewer, ""},
+		{"editor cannot delete", "DELETE", userPath, model.RoleEditor, ""},
+		{"editor cannot restore", "POST", userPath + "/restore", model.RoleEditor, ""},
+		{"editor cannot read audit", "GET", userPath + "/audit", model.RoleEditor, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, env.call(tt.method, tt.path, env.token(t, tt.role), tt.body), http.StatusForbidden, CodeForbidden)
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	env := newTestEnv(t)
+	for i := 1; i <= 3; i++ {
+		env.users.add(fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i)
+	}
+	viewer := env.token(t, model.RoleViewer)
+
+	rec := env.call("GET", "/users?page=1&limit=2", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	var page listResponse
+	decodeBody(t, rec, &page)
+	if len(page.Data) != 2 || page.Total != 3 || page.TotalPages != 2 || page.Limit != 2 {
+		t.Fatalf("page = %+v, want 2 of 3 users on 2 pages", page)
+	}
+	if !strings.Contains(rec.Header().Get("Link"), `rel="next"`) {
+		t.Fatalf("Link = %q, want a next page", rec.Header().Get("Link"))
+	}
+
+	// Слишком большая страница уменьшается, а не отклоняется
+	rec = env.call("GET", "/users?limit=100000", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	decodeBody(t, rec, &page)
+	if page.Limit != maxUsersLimit {
+		t.Fatalf("limit = %d, want %d", page.Limit, maxUsersLimit)
+	}
+
+	rec = env.call("GET", "/users?snapshot=true", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("X-Snapshot-Token") == "" {
+		t.Fatal("snapshot=true returned no X-Snapshot-Token")
+	}
+}
+
+func TestListUsersRejectsBadParameters(t *testing.T) {
+	env := newTestEnv(t)
+	viewer := env.token(t, model.RoleViewer)
+
+	tests := []struct {
+		name, query string
+		status      int
+		code        string
+	}{
+		{"age not an integer", "age=old", http.StatusBadRequest, CodeBadRequest},
+		{"verified not a boolean", "verified=maybe", http.StatusBadRequest, CodeBadRequest},
+		{"unknown sort field", "sort=password", http.StatusBadRequest, CodeBadRequest},
+		{"too many sort fields", "sort=id,name,email,age", http.StatusBadRequest, CodeBadRequest},
+		{"bad snapshot token", "snapshot=%21%21", http.StatusBadRequest, CodeBadRequest},
+		{"include_deleted not a boolean", "include_deleted=maybe", http.StatusBadRequest, CodeBadRequest},
+		{"include_deleted for a viewer", "include_deleted=true", http.StatusForbidden, CodeForbidden},
+		{"page with cursor", "page=2&cursor=", http.StatusBadRequest, CodeBadRequest},
+		{"bad cursor", "cursor=%21%21", http.StatusBadRequest, CodeBadRequest},
+		{"cursor with sort by name", "cursor=&sort=name", http.StatusBadRequest, CodeBadRequest},
+		{"cursor with snapshot", "cursor=&snapshot=true", http.StatusBadRequest, CodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, env.call("GET", "/users?"+tt.query, viewer, ""), tt.status, tt.code)
+		})
+	}
+}
+
+func TestListUsersByCursor(t *testing.T) {
+	env := newTestEnv(t)
+	for i := 1; i <= 3; i++ {
+		env.users.add(fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i)
+	}
+	viewer := env.token(t, model.RoleViewer)
+
+	var ids []int
+	path := "/users?cursor=&limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor pagination does not end")
+		}
+		rec := env.call("GET", path, viewer, "")
+		checkStatus(t, rec, http.StatusOK)
+		var page cursorListResponse
+		decodeBody(t, rec, &page)
+		for _, user := range page.Data {
+			ids = append(ids, user.ID)
+		}
+		path = ""
+		if page.NextCursor != nil {
+			path = "/users?limit=2&cursor=" + *page.NextCursor
+		}
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Fatalf("cursor pages returned ids %v, want [1 2 3]", ids)
+	}
+}
+
+func TestListUsersStorageErrors(t *testing.T) {
+	env := newTestEnv(t)
+	viewer := env.token(t, model.RoleViewer)
+
+	// Обрыв соединения с базой временный: клиенту предлагается повторить запрос
+	env.users.err = io.ErrUnexpectedEOF
+	rec := env.call("GET", "/users", viewer, "")
+	checkError(t, rec, http.StatusServiceUnavailable, CodeUnavailable)
+	if rec.Header().Get("Retry-After") != fmt.Sprint(env.cfg.RetryAfterSeconds) {
+		t.Fatalf("Retry-After = %q, want %d", rec.Header().Get("Retry-After"), env.cfg.RetryAfterSeconds)
+	}
+
+	env.users.err = errors.New(`pq: relation "users" does not exist`)
+	apiErr := checkError(t, env.call("GET", "/users", viewer, ""), http.StatusInternalServerError, CodeInternal)
+	if strings.Contains(apiErr.Message, "relation") {
+		t.Fatalf("500 message %q exposes the database error", apiErr.Message)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	viewer := env.token(t, model.RoleViewer)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	rec := env.call("GET", path, viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("ETag") != `"v1"` || rec.Header().Get("Cache-Control") != userCacheControl {
+		t.Fatalf("ETag %q, Cache-Control %q", rec.Header().Get("ETag"), rec.Header().Get("Cache-Control"))
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+
+	req := newRequest("GET", path, viewer, "")
+	req.Header.Set("If-None-Match", `W/"v1"`)
+	checkStatus(t, env.serve(req), http.StatusNotModified)
+
+	checkError(t, env.call("GET", path+"?include=friends", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/999", viewer, ""), http.StatusNotFound, CodeNotFound)
+}
+
+func TestCreateUser(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.MaxBodyBytes = 256 })
+	editor := env.token(t, model.RoleEditor)
+
+	rec := env.call("POST", "/users", editor, `{"name":"Alice","email":"alice@example.com","age":30}`)
+	checkStatus(t, rec, http.StatusOK)
+	var created model.User
+	decodeBody(t, rec, &created)
+	if created.ID == 0 || rec.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("created user %+v with ETag %q", created, rec.Header().Get("ETag"))
+	}
+	// Письмо подтверждения уходит фоновой задачей
+	if len(env.jobs.byID) != 1 {
+		t.Fatalf("queued %d jobs, want the verification email", len(env.jobs.byID))
+	}
+
+	apiErr := checkError(t, env.call("POST", "/users", editor, `{"name":"A","email":"not-an-email","age":200}`),
+		http.StatusBadRequest, CodeValidationFailed)
+	fields := map[string]string{}
+	for _, d := range apiErr.Details {
+		fields[d.Field] = d.Message
+	}
+	if fields["name"] == "" || fields["email"] == "" || fields["age"] == "" {
+		t.Fatalf("validation details = %+v, want name, email and age", apiErr.Details)
+	}
+
+	checkError(t, env.call("POST", "/users", editor, `{"name":"Alice Again","email":"ALICE@example.com"}`),
+		http.StatusConflict, CodeConflict)
+}
+
+func TestCreateUserRejectsBadBodies(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.MaxBodyBytes = 256 })
+	editor := env.token(t, model.RoleEditor)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{"no content type", "", `{"name":"Alice"}`, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, ""},
+		{"form content type", "application/x-www-form-urlencoded", "name=Alice", http.StatusUnsupportedMediaType, CodeUnsupportedMedia, ""},
+		{"latin-1 charset", "application/json; charset=latin1", `{"name":"Alice"}`, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, ""},
+		{"empty body", "application/json", "", http.StatusBadRequest, CodeBadRequest, ""},
+		{"malformed JSON", "application/json", `{"name":`, http.StatusBadRequest, CodeBadRequest, ""},
+		{"syntax error", "application/json", `{"name" "Alice"}`, http.StatusBadRequest, CodeBadRequest, ""},
+		{"wrong field type", "application/json", `{"name":"Alice","age":"thirty"}`, http.StatusBadRequest, CodeBadRequest, "age"},
+		{"unknown field", "application/json", `{"name":"Alice","role":"admin"}`, http.StatusBadRequest, CodeBadRequest, "role"},
+		{"array instead of object", "application/json", `[]`, http.StatusBadRequest, CodeBadRequest, ""},
+		{"two values", "application/json", `{"name":"Alice"} {}`, http.StatusBadRequest, CodeBadRequest, ""},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 300) + `"}`, http.StatusRequestEntityTooLarge, CodeTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/users", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+editor)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			apiErr := checkError(t, env.serve(req), tt.status, tt.code)
+			if tt.field != "" && (len(apiErr.Details) != 1 || apiErr.Details[0].Field != tt.field) {
+				t.Fatalf("details = %+v, want field %q", apiErr.Details, tt.field)
+			}
+		})
+	}
+}
+
+func TestUpdateUserVersions(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	editor := env.token(t, model.RoleEditor)
+	path := fmt.Sprintf("/users/%d", user.ID)
+	body := `{"name":"Alice Smith","email":"alice@example.com","age":31}`
+
+	checkError(t, env.call("PUT", path, editor, body), http.StatusPreconditionRequired, CodePreconditionReq)
+
+	for _, ifMatch := range []string{`"v7"`, `"etag-from-elsewhere"`} {
+		req := newRequest("PUT", path, editor, body)
+		req.Header.Set("If-Match", ifMatch)
+		checkError(t, env.serve(req), http.StatusPreconditionFailed, CodePrecondition)
+	}
+
+	req := newRequest("PUT", path, editor, body)
+	req.Header.Set("If-Match", `"v1"`)
+	rec := env.serve(req)
+	checkStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("ETag") != `"v2"` {
+		t.Fatalf("ETag after update = %q, want \"v2\"", rec.Header().Get("ETag"))
+	}
+
+	// Версия из тела работает так же, как If-Match
+	checkError(t, env.call("PUT", path, editor, `{"name":"Alice","email":"alice@example.com","version":1}`),
+		http.StatusPreconditionFailed, CodePrecondition)
+	checkError(t, env.call("PUT", path, editor, `{"name":"A","email":"alice@example.com","version":2}`),
+		http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("PUT", "/users/999", editor, `{"name":"Nobody","email":"nobody@example.com","version":1}`),
+		http.StatusNotFound, CodeNotFound)
+}
+
+func TestPatchUser(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	editor := env.token(t, model.RoleEditor)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	checkError(t, env.call("PATCH", path, editor, `{"age":31}`), http.StatusPreconditionRequired, CodePreconditionReq)
+	checkError(t, env.call("PATCH", path, editor, `{"age":-1,"version":1}`), http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("PATCH", path, editor, `{"age":31,"version":5}`), http.StatusPreconditionFailed, CodePrecondition)
+	checkError(t, env.call("PATCH", "/users/999", editor, `{"age":31,"version":1}`), http.StatusNotFound, CodeNotFound)
+
+	rec := env.call("PATCH", path, editor, `{"age":31,"version":1}`)
+	checkStatus(t, rec, http.StatusOK)
+	var patched model.User
+	decodeBody(t, rec, &patched)
+	if patched.Age != 31 || patched.Name != "Alice" || patched.Version != 2 {
+		t.Fatalf("patched user = %+v, want age 31, name kept, version 2", patched)
+	}
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	admin := env.token(t, model.RoleAdmin)
+	viewer := env.token(t, model.RoleViewer)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	checkError(t, env.call("POST", path+"/restore", admin, ""), http.StatusConflict, CodeConflict)
+	checkStatus(t, env.call("DELETE", path, admin, ""), http.StatusOK)
+	// Повторное удаление ничего не меняет и не считается ошибкой
+	checkStatus(t, env.call("DELETE", path, admin, ""), http.StatusOK)
+	checkError(t, env.call("GET", path, viewer, ""), http.StatusNotFound, CodeNotFound)
+
+	// Мягко удалённого видит только администратор
+	checkError(t, env.call("GET", path+"?include_deleted=true", viewer, ""), http.StatusForbidden, CodeForbidden)
+	checkStatus(t, env.call("GET", path+"?include_deleted=true", admin, ""), http.StatusOK)
+	// Журнал удалённого пользователя доступен
+	rec := env.call("GET", path+"/audit", admin, "")
+	checkStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Fatalf("audit body = %s, want an empty data list", rec.Body)
+	}
+
+	checkStatus(t, env.call("POST", path+"/restore", admin, ""), http.StatusOK)
+	checkStatus(t, env.call("GET", path, viewer, ""), http.StatusOK)
+	checkError(t, env.call("POST", "/users/999/restore", admin, ""), http.StatusNotFound, CodeNotFound)
+	checkError(t, env.call("GET", "/users/999/audit", admin, ""), http.StatusNotFound, CodeNotFound)
+}
+
+func TestEmailVerification(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	editor := env.token(t, model.RoleEditor)
+	path := fmt.Sprintf("/users/%d/verification", user.ID)
+
+	checkStatus(t, env.call("POST", path, editor, ""), http.StatusAccepted)
+	// Повторное письмо тоже уходит фоновой задачей, а не в обработчике запроса
+	if len(env.jobs.byID) != 1 {
+		t.Fatalf("queued %d jobs, want the resent verification email", len(env.jobs.byID))
+	}
+	checkError(t, env.call("POST", "/users/999/verification", editor, ""), http.StatusNotFound, CodeNotFound)
+	env.users.byID[user.ID].Verified = true
+	checkError(t, env.call("POST", path, editor, ""), http.StatusConflict, CodeConflict)
+
+	// Ссылка из письма открывается без токена доступа; свой токен доступа ссылкой не является
+	checkError(t, env.call("GET", "/users/verify?token=forged", "", ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/verify?token="+editor, "", ""), http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestSearchUsers(t *testing.T) {
+	env := newTestEnv(t)
+	env.users.add("Alice", "alice@example.com", 30)
+	viewer := env.token(t, model.RoleViewer)
+
+	checkError(t, env.call("GET", "/users/search", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/search?q=%21%21%21", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/search?q=alice&include_deleted=true", viewer, ""), http.StatusForbidden, CodeForbidden)
+
+	rec := env.call("GET", "/users/search?q=alice&limit=1000", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	var resp searchResponse
+	decodeBody(t, rec, &resp)
+	if resp.Total != 1 || len(resp.Data) != 1 || resp.Limit != searchMaxLimit {
+		t.Fatalf("search response = %+v, want one hit and limit %d", resp, searchMaxLimit)
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	env := newTestEnv(t)
+	env.users.add("Alice", "alice@example.com", 30)
+	env.users.add("Bob", "bob@example.com", 40)
+	viewer := env.token(t, model.RoleViewer)
+
+	rec := env.call("GET", "/users/export", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("Content-Type = %q, want text/csv", rec.Header().Get("Content-Type"))
+	}
+	if want := "id,name,email,age\n1,Alice,alice@example.com,30\n2,Bob,bob@example.com,40\n"; rec.Body.String() != want {
+		t.Fatalf("CSV export = %q, want %q", rec.Body, want)
+	}
+
+	rec = env.call("GET", "/users/export?format=ndjson", viewer, "")
+	checkStatus(t, rec, http.StatusOK)
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 2 {
+		t.Fatalf("NDJSON export has %d lines, want 2", lines)
+	}
+
+	checkError(t, env.call("GET", "/users/export?format=xml", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/export?sort=password", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/users/export?age=old", viewer, ""), http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestBulkCreateUsers(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.MaxImportRows = 3 })
+	editor := env.token(t, model.RoleEditor)
+
+	rec := env.call("POST", "/users/bulk", editor, `[{"name":"Alice","email":"alice@example.com"},{"name":"Bob","email":"bob@example.com"}]`)
+	checkStatus(t, rec, http.StatusCreated)
+	var report importResponse
+	decodeBody(t, rec, &report)
+	if report.Created != 2 || report.Failed != 0 {
+		t.Fatalf("report = %+v, want 2 created", report)
+	}
+
+	// В режиме atomic одна плохая строка отменяет весь импорт
+	rec = env.call("POST", "/users/bulk", editor, `[{"name":"Carol","email":"carol@example.com"},{"name":"D","email":"bad"}]`)
+	checkStatus(t, rec, http.StatusUnprocessableEntity)
+	decodeBody(t, rec, &report)
+	if report.Created != 0 || report.Failed != 2 || len(report.Errors) != 1 || report.Errors[0].Row != 2 {
+		t.Fatalf("atomic report = %+v, want nothing created and row 2 failed", report)
+	}
+
+	rec = env.call("POST", "/users/bulk?mode=partial", editor, `[{"name":"Carol","email":"carol@example.com"},{"name":"Dave","email":"alice@example.com"}]`)
+	checkStatus(t, rec, http.StatusOK)
+	decodeBody(t, rec, &report)
+	if report.Created != 1 || report.Failed != 1 || !strings.Contains(report.Errors[0].Message, "already exists") {
+		t.Fatalf("partial report = %+v, want Carol created and a conflict for row 2", report)
+	}
+
+	req := httptest.NewRequest("POST", "/users/bulk?mode=partial", strings.NewReader("email,name,age\nerin@example.com,Erin,25\n"))
+	req.Header.Set("Authorization", "Bearer "+editor)
+	req.Header.Set("Content-Type", "text/csv")
+	checkStatus(t, env.serve(req), http.StatusCreated)
+}
+
+func TestBulkCreateUsersRejects(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.MaxImportRows = 1 })
+	editor := env.token(t, model.RoleEditor)
+	twoRows := `[{"name":"Alice","email":"alice@example.com"},{"name":"Bob","email":"bob@example.com"}]`
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"unknown mode", "?mode=best-effort", "application/json", `[]`, http.StatusBadRequest, CodeBadRequest},
+		{"unsupported content type", "", "application/xml", `<users/>`, http.StatusUnsupportedMediaType, CodeUnsupportedMedia},
+		{"unknown JSON field", "", "application/json", `[{"name":"Alice","email":"alice@example.com","admin":true}]`, http.StatusBadRequest, CodeBadRequest},
+		{"CSV without email column", "", "text/csv", "name\nAlice\n", http.StatusBadRequest, CodeBadRequest},
+		{"CSV with a non-integer age", "", "text/csv", "name,email,age\nAlice,alice@example.com,old\n", http.StatusBadRequest, CodeBadRequest},
+		{"multipart without file", "", "multipart/form-data; boundary=x", "--x--\r\n", http.StatusBadRequest, CodeBadRequest},
+		{"too many rows", "", "application/json", twoRows, http.StatusRequestEntityTooLarge, CodeTooLarge},
+		{"too many rows async", "?async=true", "application/json", twoRows, http.StatusRequestEntityTooLarge, CodeTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/users/bulk"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+editor)
+			req.Header.Set("Content-Type", tt.contentType)
+			checkError(t, env.serve(req), tt.status, tt.code)
+		})
+	}
+}
+
+func TestAsyncImportJob(t *testing.T) {
+	env := newTestEnv(t)
+	editor := env.token(t, model.RoleEditor)
+
+	rec := env.call("POST", "/users/bulk?async=true", editor, `[{"name":"Alice","email":"alice@example.com"}]`)
+	checkStatus(t, rec, http.StatusAccepted)
+	var job model.Job
+	decodeBody(t, rec, &job)
+	if rec.Header().Get("Location") != fmt.Sprintf("/jobs/%d", job.ID) || job.Type != service.JobImportUsers {
+		t.Fatalf("queued job %+v at %q", job, rec.Header().Get("Location"))
+	}
+	// Задача ставится от имени учётной записи запроса; хранилище в памяти этого не делает
+	editorID := testAccounts[model.RoleEditor]
+	env.jobs.byID[job.ID].AccountID = &editorID
+
+	rec = env.call("GET", rec.Header().Get("Location"), editor, "")
+	checkStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Retry-After") != jobRetryAfter {
+		t.Fatalf("Retry-After for a queued job = %q, want %s", rec.Header().Get("Retry-After"), jobRetryAfter)
+	}
+	// Чужая задача неотличима от несуществующей, администратор видит все
+	checkError(t, env.call("GET", fmt.Sprintf("/jobs/%d", job.ID), env.token(t, model.RoleViewer), ""), http.StatusNotFound, CodeNotFound)
+	checkStatus(t, env.call("GET", fmt.Sprintf("/jobs/%d", job.ID), env.token(t, model.RoleAdmin), ""), http.StatusOK)
+	checkError(t, env.call("GET", "/jobs/999", editor, ""), http.StatusNotFound, CodeNotFound)
+	checkError(t, env.call("GET", "/jobs/1", "", ""), http.StatusUnauthorized, CodeUnauthorized)
+}
+
+func TestProfile(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add("Alice", "alice@example.com", 30)
+	editor := env.token(t, model.RoleEditor)
+	path := fmt.Sprintf("/users/%d/profile", user.ID)
+
+	checkError(t, env.call("GET", path, editor, ""), http.StatusNotFound, CodeNotFound)
+	checkError(t, env.call("PUT", path, editor, `{"phone":"call me"}`), http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("PUT", path, editor, `{"user_id":"one"}`), http.StatusBadRequest, CodeBadRequest)
+	checkStatus(t, env.call("PUT", path, editor, `{"bio":"Hello","phone":"+15551234567"}`), http.StatusOK)
+
+	rec := env.call("GET", path, editor, "")
+	checkStatus(t, rec, http.StatusOK)
+	var profile model.Profile
+	decodeBody(t, rec, &profile)
+	if profile.UserID != user.ID || profile.Bio != "Hello" {
+		t.Fatalf("profile = %+v, want bio of user %d", profile, user.ID)
+	}
+}
+
+// avatarRequest функция для создания запроса загрузки аватара с файлом data в поле field
+func avatarRequest(t *testing.T, path, token, field string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAvatar(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config, _ *Deps) { cfg.AvatarMaxBytes = 4 << 10 })
+	user := env.users.add("Alice", "alice@example.com", 30)
+	editor := env.token(t, model.RoleEditor)
+	path := fmt.Sprintf("/users/%d/avatar", user.ID)
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	checkError(t, env.call("GET", path, editor, ""), http.StatusNotFound, CodeNotFound)
+	checkError(t, env.serve(avatarRequest(t, path, editor, "picture", img.Bytes())), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.serve(avatarRequest(t, path, editor, "avatar", []byte("plain text, not an image"))),
+		http.StatusUnsupportedMediaType, CodeUnsupportedMedia)
+	checkError(t, env.serve(avatarRequest(t, path, editor, "avatar", bytes.Repeat([]byte{0}, 8<<10))),
+		http.StatusRequestEntityTooLarge, CodeTooLarge)
+	checkError(t, env.serve(avatarRequest(t, "/users/999/avatar", editor, "avatar", img.Bytes())), http.StatusNotFound, CodeNotFound)
+
+	rec := env.serve(avatarRequest(t, path, editor, "avatar", img.Bytes()))
+	checkStatus(t, rec, http.StatusOK)
+	var profile model.Profile
+	decodeBody(t, rec, &profile)
+	if profile.AvatarURL != path {
+		t.Fatalf("avatar_url = %q, want %q", profile.AvatarURL, path)
+	}
+
+	rec = env.call("GET", path, editor, "")
+	checkStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rec.Body.Bytes(), img.Bytes()) {
+		t.Fatalf("avatar Content-Type %q, %d bytes", rec.Header().Get("Content-Type"), rec.Body.Len())
+	}
+	req := newRequest("GET", path, editor, "")
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	checkStatus(t, env.serve(req), http.StatusNotModified)
+
+	rec = env.call("GET", path+"?size=thumb", editor, "")
+	checkStatus(t, rec, http.StatusOK)
+	thumb, err := png.DecodeConfig(rec.Body)
+	if err != nil || thumb.Width != env.cfg.AvatarThumbSize {
+		t.Fatalf("thumbnail width = %d (%v), want %d", thumb.Width, err, env.cfg.AvatarThumbSize)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	env := newTestEnv(t)
+	viewer := env.token(t, model.RoleViewer)
+
+	checkError(t, env.call("GET", "/events", "", ""), http.StatusUnauthorized, CodeUnauthorized)
+	req := newRequest("GET", "/events", viewer, "")
+	req.Header.Set("Last-Event-ID", "yesterday")
+	checkError(t, env.serve(req), http.StatusBadRequest, CodeBadRequest)
+
+	first := env.hub.Publish(events.Event{Type: events.UserCreated, TenantID: model.DefaultTenantID, UserID: 1})
+	env.hub.Publish(events.Event{Type: events.UserUpdated, TenantID: model.DefaultTenantID, UserID: 1})
+	env.hub.Publish(events.Event{Type: events.UserCreated, TenantID: 2, UserID: 9})
+
+	// Переподключившийся клиент получает пропущенные события своей организации; поток идёт до отключения
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req = newRequest("GET", "/events", viewer, "").WithContext(ctx)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(first.ID))
+	rec := env.serve(req)
+	checkStatus(t, rec, http.StatusOK)
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || !strings.Contains(body, "event: user.updated") {
+		t.Fatalf("stream %q with Content-Type %q, want the missed user.updated", body, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(body, "event: user.created") {
+		t.Fatalf("stream %q replays an event before Last-Event-ID or of another tenant", body)
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"laba8/model"
+)
+
+// maxDeliveriesLimit наибольшее число записей журнала доставок в одном ответе
+const maxDeliveriesLimit = 200
+
+// listWebhooks функция для получения списка подписок webhook
+func (h *Handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.webhooks.List(r.Context())
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if hooks == nil {
+		hooks = []model.Webhook{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": hooks})
+}
+
+// getWebhook функция для получения подписки по ID
+func (h *Handler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	hook, err := h.webhooks.Get(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// createWebhook функция для регистрации подписки; секрет подписи есть только в этом ответе
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook model.Webhook
+	if !h.decodeJSON(w, r, &hook) {
+		return
+	}
+
+	if err := h.webhooks.Create(r.Context(), &hook); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// updateWebhook функция для замены подписки; без поля secret ключ подписи не меняется
+func (h *Handler) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var hook model.Webhook
+	if !h.decodeJSON(w, r, &hook) {
+		return
+	}
+	hook.ID = id
+
+	if err := h.webhooks.Update(r.Context(), &hook); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// deleteWebhook функция для удаления подписки вместе с журналом доставок
+func (h *Handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.webhooks.Delete(r.Context(), id); err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveries функция для получения журнала доставок подписки: статус, число попыток,
+// код ответа и последняя ошибка. Фильтр ?status=pending|succeeded|failed, размер ?limit= (по умолчанию 50)
+func (h *Handler) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	query := r.URL.Query()
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	limit = min(limit, maxDeliveriesLimit)
+
+	deliveries, err := h.webhooks.Deliveries(r.Context(), id, query.Get("status"), limit)
+	if err != nil {
+		h.writeServiceError(w, r, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": deliveries})
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"laba8/model"
+)
+
+func TestWebhooksRequireAdmin(t *testing.T) {
+	env := newTestEnv(t)
+	editor := env.token(t, model.RoleEditor)
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/webhooks"}, {"POST", "/webhooks"}, {"GET", "/webhooks/1"},
+		{"PUT", "/webhooks/1"}, {"DELETE", "/webhooks/1"}, {"GET", "/webhooks/1/deliveries"},
+	} {
+		checkError(t, env.call(route.method, route.path, "", ""), http.StatusUnauthorized, CodeUnauthorized)
+		checkError(t, env.call(route.method, route.path, editor, ""), http.StatusForbidden, CodeForbidden)
+	}
+}
+
+func TestWebhookLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.token(t, model.RoleAdmin)
+
+	checkError(t, env.call("POST", "/webhooks", admin, `{"url":"ftp://example.com/hook"}`), http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("POST", "/webhooks", admin, `{"url":"https://example.com/hook","events":["user.renamed"]}`),
+		http.StatusBadRequest, CodeValidationFailed)
+	checkError(t, env.call("POST", "/webhooks", admin, `{"url":"https://example.com/hook","secret":"short"}`),
+		http.StatusBadRequest, CodeValidationFailed)
+
+	rec := env.call("POST", "/webhooks", admin, `{"url":"https://example.com/hook","events":["user.created","user.restored"]}`)
+	checkStatus(t, rec, http.StatusCreated)
+	var hook model.Webhook
+	decodeBody(t, rec, &hook)
+	if hook.ID == 0 || hook.Secret == "" {
+		t.Fatalf("created webhook %+v, want an id and a generated secret", hook)
+	}
+
+	// Секрет отдаётся только при создании
+	for _, path := range []string{"/webhooks", "/webhooks/1"} {
+		rec = env.call("GET", path, admin, "")
+		checkStatus(t, rec, http.StatusOK)
+		if strings.Contains(rec.Body.String(), hook.Secret) || strings.Contains(rec.Body.String(), `"secret"`) {
+			t.Fatalf("GET %s exposes the secret: %s", path, rec.Body)
+		}
+	}
+	checkError(t, env.call("GET", "/webhooks/999", admin, ""), http.StatusNotFound, CodeNotFound)
+
+	checkStatus(t, env.call("PUT", "/webhooks/1", admin, `{"url":"https://example.com/v2","disabled":true}`), http.StatusOK)
+	checkError(t, env.call("PUT", "/webhooks/999", admin, `{"url":"https://example.com/v2"}`), http.StatusNotFound, CodeNotFound)
+	checkError(t, env.call("PUT", "/webhooks/1", admin, `{"url":"not a url"}`), http.StatusBadRequest, CodeValidationFailed)
+
+	checkError(t, env.call("GET", "/webhooks/1/deliveries?status=lost", admin, ""), http.StatusBadRequest, CodeBadRequest)
+	checkError(t, env.call("GET", "/webhooks/999/deliveries", admin, ""), http.StatusNotFound, CodeNotFound)
+	rec = env.call("GET", "/webhooks/1/deliveries?status=failed", admin, "")
+	checkStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Fatalf("deliveries body = %s, want an empty data list", rec.Body)
+	}
+
+	checkStatus(t, env.call("DELETE", "/webhooks/1", admin, ""), http.StatusNoContent)
+	checkError(t, env.call("DELETE", "/webhooks/1", admin, ""), http.StatusNotFound, CodeNotFound)
+}
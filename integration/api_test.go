@@ -0,0 +1,636 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"laba8/config"
+	"laba8/handler"
+	"laba8/model"
+	"laba8/service"
+)
+
+func TestServiceEndpoints(t *testing.T) {
+	s := startServer(t)
+	for _, path := range []string{"/healthz", "/readyz", "/version", "/metrics", "/openapi.json", "/docs"} {
+		s.call(t, "GET", path, "", "").expect(t, http.StatusOK)
+	}
+	s.call(t, "GET", "/no-such-route", "", "").expect(t, http.StatusNotFound)
+}
+
+func TestRoutesRequireToken(t *testing.T) {
+	s := startServer(t)
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/users"}, {"GET", "/users/export"}, {"GET", "/users/search?q=alice"}, {"GET", "/users/1"},
+		{"POST", "/users"}, {"POST", "/users/bulk"}, {"PUT", "/users/1"}, {"PATCH", "/users/1"}, {"DELETE", "/users/1"},
+		{"GET", "/users/1/profile"}, {"PUT", "/users/1/profile"}, {"GET", "/users/1/avatar"}, {"POST", "/users/1/avatar"},
+		{"POST", "/users/1/verification"}, {"GET", "/users/1/audit"}, {"POST", "/users/1/restore"},
+		{"GET", "/jobs/1"}, {"GET", "/events"}, {"POST", "/auth/logout"},
+		{"PUT", "/admin/accounts/1/role"}, {"POST", "/admin/invites"}, {"GET", "/admin/login-audits"},
+		{"GET", "/webhooks"}, {"POST", "/webhooks"}, {"GET", "/webhooks/1"}, {"PUT", "/webhooks/1"},
+		{"DELETE", "/webhooks/1"}, {"GET", "/webhooks/1/deliveries"},
+	} {
+		s.call(t, route.method, route.path, "", "").expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+	}
+}
+
+func TestRoleAccess(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	for _, tt := range []struct {
+		name, method, path, token, body string
+	}{
+		{"viewer cannot create", "POST", "/users", tn.viewer, `{"name":"Bob","email":"bob@example.com"}`},
+		{"viewer cannot update", "PUT", path, tn.viewer, `{"name":"Bob","email":"bob@example.com","version":1}`},
+		{"viewer cannot patch", "PATCH", path, tn.viewer, `{"age":31,"version":1}`},
+		{"editor cannot delete", "DELETE", path, tn.editor, ""},
+		{"editor cannot restore", "POST", path + "/restore", tn.editor, ""},
+		{"editor cannot read audit", "GET", path + "/audit", tn.editor, ""},
+		{"editor cannot invite", "POST", "/admin/invites", tn.editor, `{"role":"viewer"}`},
+		{"editor cannot list webhooks", "GET", "/webhooks", tn.editor, ""},
+		{"viewer cannot read login audits", "GET", "/admin/login-audits", tn.viewer, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s.call(t, tt.method, tt.path, tt.token, tt.body).expectError(t, http.StatusForbidden, handler.CodeForbidden)
+		})
+	}
+	s.call(t, "GET", path, tn.viewer, "").expect(t, http.StatusOK)
+}
+
+func TestAuthFlow(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+
+	s.call(t, "POST", "/login", "", `{"username":"acme-admin","password":"wrong-password"}`).
+		expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+	// Без приглашения в организацию не попасть
+	s.call(t, "POST", "/register", "", `{"username":"stranger","password":"secret123"}`).
+		expectError(t, http.StatusForbidden, handler.CodeForbidden)
+
+	var invite struct {
+		Token string `json:"token"`
+	}
+	s.call(t, "POST", "/admin/invites", tn.admin, `{"role":"viewer"}`).expect(t, http.StatusCreated).decode(t, &invite)
+	s.call(t, "POST", "/register", "", fmt.Sprintf(`{"username":"newbie","password":"secret123","invite_token":%q}`, invite.Token)).
+		expect(t, http.StatusCreated)
+	s.call(t, "POST", "/register", "", fmt.Sprintf(`{"username":"another","password":"secret123","invite_token":%q}`, invite.Token)).
+		expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+
+	// Refresh-токен одноразовый, а повторное предъявление отзывает всю сессию
+	pair := s.login(t, "newbie")
+	body := fmt.Sprintf(`{"refresh_token":%q}`, pair.RefreshToken)
+	var rotated service.TokenPair
+	s.call(t, "POST", "/auth/refresh", "", body).expect(t, http.StatusOK).decode(t, &rotated)
+	s.call(t, "POST", "/auth/refresh", "", body).expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+	s.call(t, "POST", "/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, rotated.RefreshToken)).
+		expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+
+	pair = s.login(t, "newbie")
+	s.call(t, "GET", "/users", pair.AccessToken, "").expect(t, http.StatusOK)
+	s.call(t, "POST", "/auth/logout", pair.AccessToken, "").expect(t, http.StatusNoContent)
+	s.call(t, "GET", "/users", pair.AccessToken, "").expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+
+	// Назначенная роль действует со следующего входа
+	var account model.Account
+	s.call(t, "PUT", fmt.Sprintf("/admin/accounts/%d/role", accountID(t, s, "newbie")), tn.admin, `{"role":"editor"}`).
+		expect(t, http.StatusOK).decode(t, &account)
+	if account.Role != model.RoleEditor {
+		t.Fatalf("role after assignment = %q, want editor", account.Role)
+	}
+	s.createUser(t, s.login(t, "newbie").AccessToken, "Alice", "alice@example.com", 30)
+
+	var audits struct {
+		Data []model.LoginAudit `json:"data"`
+	}
+	s.call(t, "GET", "/admin/login-audits?success=false", tn.admin, "").expect(t, http.StatusOK).decode(t, &audits)
+	if len(audits.Data) != 1 || audits.Data[0].Username != "acme-admin" {
+		t.Fatalf("failed login audits = %+v, want the one wrong password", audits.Data)
+	}
+}
+
+// accountID функция для получения ID учётной записи по имени прямо из базы
+func accountID(t *testing.T, s *server, username string) int {
+	t.Helper()
+	account := &model.Account{}
+	if err := s.db.Model(account).Where("username = ?", username).Select(); err != nil {
+		t.Fatalf("find account %s: %v", username, err)
+	}
+	return account.ID
+}
+
+// resetTokenPattern токен из письма восстановления пароля: строка после упоминания POST /auth/reset-password
+var resetTokenPattern = regexp.MustCompile(`/auth/reset-password:\n(\S+)`)
+
+func TestPasswordReset(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	oldPair := s.login(t, "acme-editor")
+
+	s.call(t, "POST", "/auth/forgot-password", "", `{"email":"not-an-email"}`).
+		expectError(t, http.StatusBadRequest, handler.CodeValidationFailed)
+	s.call(t, "POST", "/auth/forgot-password", "", `{"email":"nobody@example.com"}`).expect(t, http.StatusAccepted)
+	s.call(t, "POST", "/auth/forgot-password", "", `{"email":"acme-editor@example.com"}`).expect(t, http.StatusAccepted)
+
+	msg := s.mail.waitFor(t, "acme-editor@example.com", "Password reset")
+	match := resetTokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("reset email has no token: %q", msg.Body)
+	}
+	s.call(t, "POST", "/auth/reset-password", "", `{"token":"guess","password":"newsecret123"}`).
+		expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+	s.call(t, "POST", "/auth/reset-password", "", fmt.Sprintf(`{"token":%q,"password":"newsecret123"}`, match[1])).
+		expect(t, http.StatusOK)
+	// Токен одноразовый
+	s.call(t, "POST", "/auth/reset-password", "", fmt.Sprintf(`{"token":%q,"password":"another123"}`, match[1])).
+		expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+
+	s.call(t, "POST", "/login", "", `{"username":"acme-editor","password":"secret123"}`).
+		expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+	s.call(t, "POST", "/login", "", `{"username":"acme-editor","password":"newsecret123"}`).expect(t, http.StatusOK)
+	// Смена пароля отзывает прежние сессии
+	s.call(t, "POST", "/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, oldPair.RefreshToken)).
+		expectError(t, http.StatusUnauthorized, handler.CodeUnauthorized)
+	s.call(t, "GET", "/users", tn.viewer, "").expect(t, http.StatusOK)
+}
+
+func TestUserLifecycle(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+	if user.ID == 0 || user.Version != 1 || user.Verified {
+		t.Fatalf("created user = %+v", user)
+	}
+	s.call(t, "POST", "/users", tn.editor, `{"name":"Alice Again","email":"ALICE@example.com"}`).
+		expectError(t, http.StatusConflict, handler.CodeConflict)
+
+	resp := s.call(t, "GET", path, tn.viewer, "").expect(t, http.StatusOK)
+	etag := resp.header.Get("ETag")
+	if etag != `"v1"` {
+		t.Fatalf("ETag = %q, want \"v1\"", etag)
+	}
+	req := s.newRequest(t, "GET", path, tn.viewer, "")
+	req.Header.Set("If-None-Match", etag)
+	s.send(t, req).expect(t, http.StatusNotModified)
+	s.call(t, "GET", "/users/999999", tn.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+
+	body := `{"name":"Alice Smith","email":"alice@example.com","age":31}`
+	s.call(t, "PUT", path, tn.editor, body).expectError(t, http.StatusPreconditionRequired, handler.CodePreconditionReq)
+	req = s.newRequest(t, "PUT", path, tn.editor, body)
+	req.Header.Set("If-Match", `"v7"`)
+	s.send(t, req).expectError(t, http.StatusPreconditionFailed, handler.CodePrecondition)
+	req = s.newRequest(t, "PUT", path, tn.editor, body)
+	req.Header.Set("If-Match", etag)
+	var updated model.User
+	s.send(t, req).expect(t, http.StatusOK).decode(t, &updated)
+	if updated.Name != "Alice Smith" || updated.Version != 2 {
+		t.Fatalf("updated user = %+v, want the new name at version 2", updated)
+	}
+
+	var patched model.User
+	s.call(t, "PATCH", path, tn.editor, `{"age":32,"version":2}`).expect(t, http.StatusOK).decode(t, &patched)
+	if patched.Age != 32 || patched.Name != "Alice Smith" || patched.Version != 3 {
+		t.Fatalf("patched user = %+v, want age 32, name kept, version 3", patched)
+	}
+	s.call(t, "PATCH", path, tn.editor, `{"age":33,"version":2}`).expectError(t, http.StatusPreconditionFailed, handler.CodePrecondition)
+
+	s.call(t, "DELETE", path, tn.admin, "").expect(t, http.StatusOK)
+	s.call(t, "GET", path, tn.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	s.call(t, "GET", path+"?include_deleted=true", tn.viewer, "").expectError(t, http.StatusForbidden, handler.CodeForbidden)
+	s.call(t, "GET", path+"?include_deleted=true", tn.admin, "").expect(t, http.StatusOK)
+	// Email удалённого пользователя свободен
+	s.createUser(t, tn.editor, "Alice Clone", "alice@example.com", 20)
+	s.call(t, "POST", path+"/restore", tn.admin, "").expectError(t, http.StatusConflict, handler.CodeConflict)
+
+	var audit struct {
+		Data []model.AuditLog `json:"data"`
+	}
+	s.call(t, "GET", path+"/audit", tn.admin, "").expect(t, http.StatusOK).decode(t, &audit)
+	var actions []string
+	for _, entry := range audit.Data {
+		actions = append(actions, entry.Action)
+		if entry.Actor == "" {
+			t.Fatalf("audit entry %+v has no actor", entry)
+		}
+	}
+	for _, want := range []string{model.AuditCreate, model.AuditUpdate, model.AuditDelete} {
+		if !strings.Contains(strings.Join(actions, ","), want) {
+			t.Fatalf("audit actions = %v, want %s", actions, want)
+		}
+	}
+}
+
+// verifyLinkPattern ссылка подтверждения email из письма
+var verifyLinkPattern = regexp.MustCompile(`/users/verify\?token=\S+`)
+
+func TestEmailVerification(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+
+	msg := s.mail.waitFor(t, "alice@example.com", "Confirm your email address")
+	link := verifyLinkPattern.FindString(msg.Body)
+	if link == "" {
+		t.Fatalf("verification email has no link: %q", msg.Body)
+	}
+	s.call(t, "GET", "/users/verify?token=forged", "", "").expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+	s.call(t, "GET", link, "", "").expect(t, http.StatusOK)
+
+	var verified model.User
+	s.call(t, "GET", fmt.Sprintf("/users/%d", user.ID), tn.viewer, "").expect(t, http.StatusOK).decode(t, &verified)
+	if !verified.Verified {
+		t.Fatal("user is not verified after opening the link")
+	}
+	s.call(t, "POST", fmt.Sprintf("/users/%d/verification", user.ID), tn.editor, "").
+		expectError(t, http.StatusConflict, handler.CodeConflict)
+}
+
+func TestValidationFailures(t *testing.T) {
+	s := startServer(t, func(cfg *config.Config) { cfg.MaxBodyBytes = 512 })
+	tn := s.newTenant(t, "acme")
+
+	apiErr := s.call(t, "POST", "/users", tn.editor, `{"name":"A","email":"not-an-email","age":200}`).
+		expectError(t, http.StatusBadRequest, handler.CodeValidationFailed)
+	fields := map[string]bool{}
+	for _, d := range apiErr.Details {
+		fields[d.Field] = true
+	}
+	if !fields["name"] || !fields["email"] || !fields["age"] {
+		t.Fatalf("validation details = %+v, want name, email and age", apiErr.Details)
+	}
+
+	for _, tt := range []struct {
+		name, contentType, body string
+		status                  int
+		code                    string
+	}{
+		{"no content type", "", `{"name":"Alice"}`, http.StatusUnsupportedMediaType, handler.CodeUnsupportedMedia},
+		{"malformed JSON", "application/json", `{"name":`, http.StatusBadRequest, handler.CodeBadRequest},
+		{"wrong field type", "application/json", `{"name":"Alice","age":"thirty"}`, http.StatusBadRequest, handler.CodeBadRequest},
+		{"unknown field", "application/json", `{"name":"Alice","role":"admin"}`, http.StatusBadRequest, handler.CodeBadRequest},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 600) + `"}`, http.StatusRequestEntityTooLarge, handler.CodeTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := s.newRawRequest(t, "POST", "/users", tn.editor, tt.contentType, strings.NewReader(tt.body))
+			s.send(t, req).expectError(t, tt.status, tt.code)
+		})
+	}
+
+	for _, query := range []string{"age=old", "verified=maybe", "sort=password", "page=2&cursor=", "cursor=%21%21", "snapshot=%21%21"} {
+		s.call(t, "GET", "/users?"+query, tn.viewer, "").expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+	}
+	var page struct {
+		Total int `json:"total"`
+	}
+	s.call(t, "GET", "/users", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 0 {
+		t.Fatalf("rejected requests stored %d users", page.Total)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	var rows []string
+	for i := 1; i <= 25; i++ {
+		rows = append(rows, fmt.Sprintf(`{"name":"User %02d","email":"user%02d@example.com","age":%d}`, i, i, 20+i))
+	}
+	s.call(t, "POST", "/users/bulk", tn.editor, "["+strings.Join(rows, ",")+"]").expect(t, http.StatusCreated)
+
+	var page struct {
+		Data       []model.User `json:"data"`
+		Total      int          `json:"total"`
+		Page       int          `json:"page"`
+		Limit      int          `json:"limit"`
+		TotalPages int          `json:"total_pages"`
+	}
+	resp := s.call(t, "GET", "/users?page=2&limit=10", tn.viewer, "").expect(t, http.StatusOK)
+	resp.decode(t, &page)
+	if len(page.Data) != 10 || page.Total != 25 || page.TotalPages != 3 || page.Page != 2 || page.Data[0].Name != "User 11" {
+		t.Fatalf("page 2 = %+v, want users 11-20 of 25", page)
+	}
+	link := resp.header.Get("Link")
+	if !strings.Contains(link, `rel="prev"`) || !strings.Contains(link, `rel="next"`) {
+		t.Fatalf("Link = %q, want prev and next", link)
+	}
+	s.call(t, "GET", "/users?page=3&limit=10", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 5 {
+		t.Fatalf("last page has %d users, want 5", len(page.Data))
+	}
+	s.call(t, "GET", "/users?limit=100000", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Limit != 100 || len(page.Data) != 25 {
+		t.Fatalf("clamped page = limit %d with %d users, want limit 100 with all 25", page.Limit, len(page.Data))
+	}
+
+	// Фильтры и сортировка выполняются в базе
+	s.call(t, "GET", "/users?age_gte=40&sort=age:desc", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 6 || page.Data[0].Age != 45 || page.Data[5].Age != 40 {
+		t.Fatalf("age_gte=40 sorted by age desc = %+v, want ages 45 down to 40", page)
+	}
+	s.call(t, "GET", "/users?name_like=user%201", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 10 {
+		t.Fatalf("name_like=user 1 matched %d users, want 10", page.Total)
+	}
+
+	// Keyset-пагинация обходит все строки без пропусков и повторов
+	var ids []int
+	path := "/users?cursor=&limit=7"
+	for pages := 0; path != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor pagination does not end")
+		}
+		var cursorPage struct {
+			Data       []model.User `json:"data"`
+			NextCursor *string      `json:"next_cursor"`
+		}
+		s.call(t, "GET", path, tn.viewer, "").expect(t, http.StatusOK).decode(t, &cursorPage)
+		for _, user := range cursorPage.Data {
+			if len(ids) > 0 && user.ID <= ids[len(ids)-1] {
+				t.Fatalf("cursor page returned id %d after %d", user.ID, ids[len(ids)-1])
+			}
+			ids = append(ids, user.ID)
+		}
+		path = ""
+		if cursorPage.NextCursor != nil {
+			path = "/users?limit=7&cursor=" + url.QueryEscape(*cursorPage.NextCursor)
+		}
+	}
+	if len(ids) != 25 {
+		t.Fatalf("cursor pages returned %d users, want 25", len(ids))
+	}
+}
+
+func TestBulkImport(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+
+	var report struct {
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+	}
+	s.call(t, "POST", "/users/bulk", tn.editor, `[{"name":"Carol","email":"carol@example.com"},{"name":"D","email":"bad"}]`).
+		expect(t, http.StatusUnprocessableEntity).decode(t, &report)
+	if report.Created != 0 {
+		t.Fatalf("atomic import with a bad row created %d users", report.Created)
+	}
+	s.call(t, "POST", "/users/bulk?mode=partial", tn.editor, `[{"name":"Carol","email":"carol@example.com"},{"name":"D","email":"bad"}]`).
+		expect(t, http.StatusOK).decode(t, &report)
+	if report.Created != 1 || report.Failed != 1 {
+		t.Fatalf("partial report = %+v, want one created and one failed", report)
+	}
+
+	csv := strings.NewReader("email,name,age\nerin@example.com,Erin,25\n")
+	s.send(t, s.newRawRequest(t, "POST", "/users/bulk", tn.editor, "text/csv", csv)).expect(t, http.StatusCreated)
+
+	resp := s.call(t, "POST", "/users/bulk?async=true", tn.editor, `[{"name":"Frank","email":"frank@example.com"}]`).
+		expect(t, http.StatusAccepted)
+	location := resp.header.Get("Location")
+	var job model.Job
+	eventually(t, "the import job", func() bool {
+		s.call(t, "GET", location, tn.editor, "").expect(t, http.StatusOK).decode(t, &job)
+		return job.Status == model.JobSucceeded || job.Status == model.JobFailed
+	})
+	if job.Status != model.JobSucceeded || job.Type != service.JobImportUsers {
+		t.Fatalf("import job = %+v, want a succeeded %s", job, service.JobImportUsers)
+	}
+	// Чужая задача неотличима от несуществующей
+	s.call(t, "GET", location, tn.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+
+	var page struct {
+		Total int `json:"total"`
+	}
+	s.call(t, "GET", "/users", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 3 {
+		t.Fatalf("imported %d users, want Carol, Erin and Frank", page.Total)
+	}
+}
+
+func TestSearchAndExport(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	s.createUser(t, tn.editor, "Alice Walker", "alice@example.com", 30)
+	s.createUser(t, tn.editor, "Bob Stone", "bob@example.com", 40)
+
+	var found struct {
+		Data  []model.UserSearchHit `json:"data"`
+		Total int                   `json:"total"`
+	}
+	s.call(t, "GET", "/users/search?q=walker", tn.viewer, "").expect(t, http.StatusOK).decode(t, &found)
+	if found.Total != 1 || found.Data[0].User.Name != "Alice Walker" || !strings.Contains(found.Data[0].Highlight["name"], "<mark>") {
+		t.Fatalf("search for walker = %+v, want Alice highlighted", found)
+	}
+	s.call(t, "GET", "/users/search", tn.viewer, "").expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+
+	resp := s.call(t, "GET", "/users/export", tn.viewer, "").expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("export Content-Type = %q, want text/csv", resp.header.Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(string(resp.body)), "\n")
+	if len(lines) != 3 || lines[0] != "id,name,email,age" || !strings.HasSuffix(lines[2], ",Bob Stone,bob@example.com,40") {
+		t.Fatalf("CSV export = %q, want a header and two users", resp.body)
+	}
+	resp = s.call(t, "GET", "/users/export?format=ndjson&age_gte=35", tn.viewer, "").expect(t, http.StatusOK)
+	if strings.Count(string(resp.body), "\n") != 1 || !strings.Contains(string(resp.body), "bob@example.com") {
+		t.Fatalf("NDJSON export with age_gte=35 = %q, want only Bob", resp.body)
+	}
+	s.call(t, "GET", "/users/export?format=xml", tn.viewer, "").expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+}
+
+func TestProfileAndAvatar(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	s.call(t, "GET", path+"/profile", tn.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	s.call(t, "PUT", path+"/profile", tn.editor, `{"phone":"call me"}`).expectError(t, http.StatusBadRequest, handler.CodeValidationFailed)
+	s.call(t, "PUT", path+"/profile", tn.editor, `{"bio":"Hello","phone":"+15551234567"}`).expect(t, http.StatusOK)
+	var withProfile model.User
+	s.call(t, "GET", path+"?include=profile", tn.viewer, "").expect(t, http.StatusOK).decode(t, &withProfile)
+	if withProfile.Profile == nil || withProfile.Profile.Bio != "Hello" || withProfile.Profile.Phone != "+15551234567" {
+		t.Fatalf("user with profile = %+v, want the saved profile", withProfile)
+	}
+	s.call(t, "PUT", "/users/999999/profile", tn.editor, `{"bio":"Nobody"}`).expectError(t, http.StatusNotFound, handler.CodeNotFound)
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	s.send(t, avatarRequest(t, s, path+"/avatar", tn.editor, []byte("plain text, not an image"))).
+		expectError(t, http.StatusUnsupportedMediaType, handler.CodeUnsupportedMedia)
+	var profile model.Profile
+	s.send(t, avatarRequest(t, s, path+"/avatar", tn.editor, img.Bytes())).expect(t, http.StatusOK).decode(t, &profile)
+	if profile.AvatarURL != path+"/avatar" || profile.Bio != "Hello" {
+		t.Fatalf("profile after upload = %+v, want the avatar URL and the bio kept", profile)
+	}
+	resp := s.call(t, "GET", path+"/avatar", tn.viewer, "").expect(t, http.StatusOK)
+	if resp.header.Get("Content-Type") != "image/png" || !bytes.Equal(resp.body, img.Bytes()) {
+		t.Fatalf("avatar Content-Type %q, %d bytes", resp.header.Get("Content-Type"), len(resp.body))
+	}
+	resp = s.call(t, "GET", path+"/avatar?size=thumb", tn.viewer, "").expect(t, http.StatusOK)
+	thumb, err := png.DecodeConfig(bytes.NewReader(resp.body))
+	if err != nil || thumb.Width != s.cfg.AvatarThumbSize {
+		t.Fatalf("thumbnail width = %d (%v), want %d", thumb.Width, err, s.cfg.AvatarThumbSize)
+	}
+}
+
+// avatarRequest функция для создания запроса загрузки аватара с файлом data
+func avatarRequest(t *testing.T, s *server, path, token string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+	return s.newRawRequest(t, "POST", path, token, form.FormDataContentType(), &body)
+}
+
+// hookReceiver структура получателя webhook, который запоминает типы пришедших событий
+type hookReceiver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *hookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(service.WebhookSignatureHeader) == "" {
+		http.Error(w, "unsigned", http.StatusUnauthorized)
+		return
+	}
+	h.mu.Lock()
+	h.events = append(h.events, r.Header.Get(service.WebhookEventHeader))
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// received функция для проверки, пришло ли событие eventType
+func (h *hookReceiver) received(eventType string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWebhooksAndEvents(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	receiver := &hookReceiver{}
+	hookServer := httptest.NewServer(receiver)
+	defer hookServer.Close()
+
+	s.call(t, "POST", "/webhooks", tn.admin, `{"url":"ftp://example.com/hook"}`).
+		expectError(t, http.StatusBadRequest, handler.CodeValidationFailed)
+	var hook model.Webhook
+	s.call(t, "POST", "/webhooks", tn.admin, fmt.Sprintf(`{"url":%q,"events":["user.created"]}`, hookServer.URL)).
+		expect(t, http.StatusCreated).decode(t, &hook)
+	hookPath := fmt.Sprintf("/webhooks/%d", hook.ID)
+	if resp := s.call(t, "GET", hookPath, tn.admin, "").expect(t, http.StatusOK); strings.Contains(string(resp.body), hook.Secret) {
+		t.Fatalf("GET %s exposes the secret", hookPath)
+	}
+
+	// Поток событий открывается до изменения, чтобы получить его в реальном времени
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	req := s.newRequest(t, "GET", "/events", tn.viewer, "").WithContext(ctx)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK || stream.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events = %d %q", stream.StatusCode, stream.Header.Get("Content-Type"))
+	}
+
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	lines := bufio.NewScanner(stream.Body)
+	var event string
+	for event == "" && lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "event: ") {
+			event = strings.TrimPrefix(lines.Text(), "event: ")
+		}
+	}
+	if event != "user.created" {
+		t.Fatalf("first streamed event = %q (%v), want user.created", event, lines.Err())
+	}
+	if !lines.Scan() || !strings.Contains(lines.Text(), fmt.Sprintf(`"user_id":%d`, user.ID)) {
+		t.Fatalf("user.created data = %q, want user %d", lines.Text(), user.ID)
+	}
+
+	eventually(t, "the user.created webhook", func() bool { return receiver.received("user.created") })
+	var deliveries struct {
+		Data []model.WebhookDelivery `json:"data"`
+	}
+	eventually(t, "the delivery to be recorded", func() bool {
+		s.call(t, "GET", hookPath+"/deliveries?status=succeeded", tn.admin, "").expect(t, http.StatusOK).decode(t, &deliveries)
+		return len(deliveries.Data) == 1
+	})
+	if deliveries.Data[0].EventType != "user.created" || deliveries.Data[0].ResponseCode != http.StatusNoContent {
+		t.Fatalf("delivery = %+v, want user.created answered with 204", deliveries.Data[0])
+	}
+
+	s.call(t, "PUT", hookPath, tn.admin, fmt.Sprintf(`{"url":%q,"disabled":true}`, hookServer.URL)).expect(t, http.StatusOK)
+	s.call(t, "DELETE", hookPath, tn.admin, "").expect(t, http.StatusNoContent)
+	s.call(t, "GET", hookPath, tn.admin, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s := startServer(t)
+	acme := s.newTenant(t, "acme")
+	globex := s.newTenant(t, "globex")
+	user := s.createUser(t, acme.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	// Другая организация не видит пользователя и не может его изменить
+	s.call(t, "GET", path, globex.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	s.call(t, "PATCH", path, globex.editor, `{"age":31,"version":1}`).expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	// Удаление отсутствующего пользователя ошибкой не считается, но пользователь другой организации остаётся
+	s.call(t, "DELETE", path, globex.admin, "").expect(t, http.StatusOK)
+	s.call(t, "GET", path, acme.viewer, "").expect(t, http.StatusOK)
+	var page struct {
+		Total int `json:"total"`
+	}
+	s.call(t, "GET", "/users", globex.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 0 {
+		t.Fatalf("globex sees %d users, want none", page.Total)
+	}
+	s.call(t, "GET", "/users/search?q=alice", globex.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 0 {
+		t.Fatalf("globex search finds %d users, want none", page.Total)
+	}
+	if resp := s.call(t, "GET", "/users/export", globex.viewer, "").expect(t, http.StatusOK); strings.Contains(string(resp.body), "alice") {
+		t.Fatalf("globex export contains acme users: %q", resp.body)
+	}
+	// Тот же email в другой организации не занят
+	s.createUser(t, globex.editor, "Alice", "alice@example.com", 30)
+
+	// X-Tenant с токеном может только подтвердить организацию токена
+	req := s.newRequest(t, "GET", "/users", acme.viewer, "")
+	req.Header.Set("X-Tenant", "globex")
+	s.send(t, req).expectError(t, http.StatusForbidden, handler.CodeForbidden)
+	req.Header.Set("X-Tenant", "acme")
+	s.send(t, req).expect(t, http.StatusOK)
+}
@@ -0,0 +1,10 @@
+// Package integration содержит сквозные тесты сервиса поверх настоящего Postgres: сервер собирается через app.New,
+// как в main, и проверяется запросами по HTTP. Тесты собираются только с тегом integration и по умолчанию
+// подключаются к базе из docker-compose.yml:
+//
+//	docker compose up -d --wait db
+//	go test -tags=integration ./...
+//
+// Другой сервер Postgres задаётся в TEST_DATABASE_URL. Каждый тест создаёт себе отдельную пустую базу
+// с миграциями с нуля и удаляет её после себя.
+package integration
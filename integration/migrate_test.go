@@ -0,0 +1,123 @@
+//go:build integration
+
+package integration
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/config"
+	"laba8/repository"
+)
+
+// migrationLockID ключ advisory-блокировки миграций, как в repository
+const migrationLockID = 8008
+
+// migrationResult структура результата одного запуска Migrate
+type migrationResult struct {
+	oldVersion, newVersion int64
+	err                    error
+}
+
+// connectTo функция для отдельного подключения к базе dbURL, как у ещё одного экземпляра сервиса
+func connectTo(t *testing.T, dbURL string) *pg.DB {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DatabaseURL = dbURL
+	return connect(t, &cfg)
+}
+
+func TestConcurrentMigrations(t *testing.T) {
+	dbURL := newDatabase(t)
+
+	// Два экземпляра стартуют одновременно на пустой базе
+	results := make([]migrationResult, 2)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range results {
+		db := connectTo(t, dbURL)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			r := &results[i]
+			r.oldVersion, r.newVersion, r.err = repository.Migrate(db, "up")
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	_, latest, err := repository.MigrationStatus(connectTo(t, dbURL))
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	migrated := 0
+	for i, r := range results {
+		if r.err != nil {
+			t.Fatalf("migrator %d failed: %v", i, r.err)
+		}
+		if r.newVersion != latest {
+			t.Fatalf("migrator %d finished at version %d, want %d", i, r.newVersion, latest)
+		}
+		if r.oldVersion == 0 {
+			migrated++
+		}
+	}
+	// Второй ждал блокировку и увидел уже готовую схему, а не применял миграции повторно
+	if migrated != 1 {
+		t.Fatalf("%d migrators started from an empty schema, want exactly one: %+v", migrated, results)
+	}
+}
+
+func TestMigrationWaitsForLock(t *testing.T) {
+	dbURL := newDatabase(t)
+	holder := connectTo(t, dbURL)
+	conn := holder.Conn()
+	defer conn.Close()
+	if _, err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := connectTo(t, dbURL)
+	done := make(chan migrationResult, 1)
+	go func() {
+		var r migrationResult
+		r.oldVersion, r.newVersion, r.err = repository.Migrate(migrator, "up")
+		done <- r
+	}()
+
+	// Пока блокировку держит другой экземпляр, миграции ждут её в pg_advisory_lock
+	eventually(t, "the migrator to wait for the advisory lock", func() bool {
+		var waiting int
+		_, err := holder.QueryOne(pg.Scan(&waiting),
+			"SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND NOT granted AND objid = ?", migrationLockID)
+		return err == nil && waiting == 1
+	})
+	select {
+	case r := <-done:
+		t.Fatalf("Migrate finished while the lock was held: %+v", r)
+	case <-time.After(200 * time.Millisecond):
+	}
+	var tables int
+	if _, err := holder.QueryOne(pg.Scan(&tables), "SELECT count(*) FROM pg_tables WHERE tablename = 'users'"); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatal("schema was created while the migration lock was held")
+	}
+
+	if _, err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil || r.oldVersion != 0 || r.newVersion == 0 {
+			t.Fatalf("Migrate after the lock was released = %+v, want a full run from version 0", r)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Migrate did not finish after the lock was released")
+	}
+}
@@ -0,0 +1,52 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"laba8/handler"
+	"laba8/model"
+)
+
+func TestSoftDeleteKeepsProfile(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+	s.call(t, "PUT", path+"/profile", tn.editor, `{"bio":"Hello","address":"Baker Street 221b"}`).expect(t, http.StatusOK)
+
+	// Мягкое удаление скрывает профиль вместе с пользователем, но строка profiles остаётся
+	s.call(t, "DELETE", path, tn.admin, "").expect(t, http.StatusOK)
+	s.call(t, "GET", path+"/profile", tn.viewer, "").expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	s.call(t, "PUT", path+"/profile", tn.editor, `{"bio":"Changed"}`).expectError(t, http.StatusNotFound, handler.CodeNotFound)
+	kept := &model.Profile{UserID: user.ID}
+	if err := s.db.Model(kept).WherePK().Select(); err != nil {
+		t.Fatalf("profile of the soft-deleted user is gone: %v", err)
+	}
+	if kept.Bio != "Hello" {
+		t.Fatalf("stored profile = %+v, want the bio before deletion", kept)
+	}
+
+	// Восстановление возвращает профиль без изменений
+	s.call(t, "POST", path+"/restore", tn.admin, "").expect(t, http.StatusOK)
+	var restored model.Profile
+	s.call(t, "GET", path+"/profile", tn.viewer, "").expect(t, http.StatusOK).decode(t, &restored)
+	if restored.Bio != "Hello" || restored.Address != "Baker Street 221b" {
+		t.Fatalf("profile after restore = %+v, want the one saved before deletion", restored)
+	}
+
+	// ON DELETE CASCADE срабатывает при физическом удалении строки users
+	if _, err := s.db.Exec("DELETE FROM users WHERE id = ?", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	count, err := s.db.Model((*model.Profile)(nil)).Where("user_id = ?", user.ID).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d profiles left after the user row was deleted, want the cascade to remove it", count)
+	}
+}
@@ -0,0 +1,228 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/config"
+	"laba8/handler"
+	"laba8/model"
+)
+
+// usersPage структура страницы GET /users
+type usersPage struct {
+	Data       []model.User `json:"data"`
+	Total      int          `json:"total"`
+	TotalPages int          `json:"total_pages"`
+}
+
+func TestSnapshotPagination(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	var want []int
+	for i := 1; i <= 5; i++ {
+		want = append(want, s.createUser(t, tn.editor, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i).ID)
+	}
+
+	var page usersPage
+	resp := s.call(t, "GET", "/users?page=1&limit=2&snapshot=true", tn.viewer, "").expect(t, http.StatusOK)
+	resp.decode(t, &page)
+	token := resp.header.Get("X-Snapshot-Token")
+	if token == "" {
+		t.Fatal("snapshot=true returned no X-Snapshot-Token")
+	}
+	if !strings.Contains(resp.header.Get("Link"), "snapshot="+url.QueryEscape(token)) {
+		t.Fatalf("Link = %q, want the next page in the same snapshot", resp.header.Get("Link"))
+	}
+	got := []int{page.Data[0].ID, page.Data[1].ID}
+
+	// Строки, вставленные между страницами, в снимок не попадают и не сдвигают следующие страницы
+	for i := 6; i <= 8; i++ {
+		s.createUser(t, tn.editor, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i)
+	}
+	for p := 2; p <= 3; p++ {
+		resp = s.call(t, "GET", fmt.Sprintf("/users?page=%d&limit=2&snapshot=%s", p, url.QueryEscape(token)), tn.viewer, "").
+			expect(t, http.StatusOK)
+		resp.decode(t, &page)
+		if page.Total != 5 || page.TotalPages != 3 {
+			t.Fatalf("snapshot page %d has total %d on %d pages, want 5 on 3", p, page.Total, page.TotalPages)
+		}
+		if resp.header.Get("X-Snapshot-Token") != token {
+			t.Fatalf("snapshot page %d returned token %q, want %q", p, resp.header.Get("X-Snapshot-Token"), token)
+		}
+		for _, user := range page.Data {
+			got = append(got, user.ID)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("snapshot pages returned ids %v, want %v", got, want)
+	}
+
+	// Без снимка новые строки видны сразу
+	s.call(t, "GET", "/users?page=1&limit=2", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if page.Total != 8 {
+		t.Fatalf("total without snapshot = %d, want 8", page.Total)
+	}
+}
+
+// seedUsers функция для быстрой вставки n пользователей организации slug одним запросом в обход API;
+// после вставки обновляется статистика, чтобы планировщик знал размер таблицы
+func seedUsers(t *testing.T, s *server, slug string, n int) {
+	t.Helper()
+	_, err := s.db.Exec(`INSERT INTO users (tenant_id, name, email, age)
+		SELECT t.id, 'Seeded ' || g, 'seeded' || g || '@example.com', g % 100
+		FROM tenants t, generate_series(1, ?) g WHERE t.slug = ?`, n, slug)
+	if err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+	if _, err := s.db.Exec("ANALYZE users"); err != nil {
+		t.Fatalf("analyze users: %v", err)
+	}
+}
+
+func TestQueryCostCeiling(t *testing.T) {
+	s := startServer(t, func(cfg *config.Config) { cfg.QueryCostCeiling = 1000 })
+	tn := s.newTenant(t, "acme")
+	seedUsers(t, s, "acme", 100000)
+
+	// Первая страница читается по индексу (tenant_id, id) и стоит единицы
+	var page usersPage
+	s.call(t, "GET", "/users?page=1&limit=10", tn.viewer, "").expect(t, http.StatusOK).decode(t, &page)
+	if len(page.Data) != 10 || page.Total != 100000 {
+		t.Fatalf("first page = %d users of %d, want 10 of 100000", len(page.Data), page.Total)
+	}
+	// Глубокий OFFSET без фильтров проходит почти всю таблицу — его оценка выше потолка
+	apiErr := s.call(t, "GET", "/users?page=9990&limit=10", tn.viewer, "").expectError(t, http.StatusBadRequest, handler.CodeBadRequest)
+	if !strings.Contains(apiErr.Message, "selective filters") {
+		t.Fatalf("rejection message = %q, want a hint about filters", apiErr.Message)
+	}
+	// Keyset-пагинация не использует OFFSET, поэтому каждая её страница стоит как первая
+	s.call(t, "GET", "/users?cursor=&limit=10", tn.viewer, "").expect(t, http.StatusOK)
+}
+
+// rowState функция для получения xmin строки пользователя (меняется при каждой записи строки)
+// и числа событий outbox о нём
+func rowState(t *testing.T, s *server, id int) (xmin string, events int) {
+	t.Helper()
+	if _, err := s.db.QueryOne(pg.Scan(&xmin), "SELECT xmin::text FROM users WHERE id = ?", id); err != nil {
+		t.Fatalf("read xmin: %v", err)
+	}
+	if _, err := s.db.QueryOne(pg.Scan(&events), "SELECT count(*) FROM outbox_events WHERE user_id = ?", id); err != nil {
+		t.Fatalf("count outbox events: %v", err)
+	}
+	return xmin, events
+}
+
+func TestNoopUpdateSkipsWrite(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	path := fmt.Sprintf("/users/%d", user.ID)
+	xmin, events := rowState(t, s, user.ID)
+
+	// PUT и PATCH с теми же значениями отвечают 200 с прежней версией и ничего не пишут
+	req := s.newRequest(t, "PUT", path, tn.editor, `{"name":"Alice","email":"alice@example.com","age":30}`)
+	req.Header.Set("If-Match", `"v1"`)
+	resp := s.send(t, req).expect(t, http.StatusOK)
+	if resp.header.Get("ETag") != `"v1"` {
+		t.Fatalf("ETag after a no-op PUT = %q, want \"v1\"", resp.header.Get("ETag"))
+	}
+	var patched model.User
+	s.call(t, "PATCH", path, tn.editor, `{"age":30,"version":1}`).expect(t, http.StatusOK).decode(t, &patched)
+	if patched.Version != 1 {
+		t.Fatalf("version after a no-op PATCH = %d, want 1", patched.Version)
+	}
+	if gotXmin, gotEvents := rowState(t, s, user.ID); gotXmin != xmin || gotEvents != events {
+		t.Fatalf("no-op updates wrote the row (xmin %s -> %s) or events (%d -> %d)", xmin, gotXmin, events, gotEvents)
+	}
+	var audit struct {
+		Data []model.AuditLog `json:"data"`
+	}
+	s.call(t, "GET", path+"/audit", tn.admin, "").expect(t, http.StatusOK).decode(t, &audit)
+	if len(audit.Data) != 1 || audit.Data[0].Action != model.AuditCreate {
+		t.Fatalf("audit after no-op updates = %+v, want only the creation", audit.Data)
+	}
+
+	// Настоящее изменение записывается как раньше
+	s.call(t, "PATCH", path, tn.editor, `{"age":31,"version":1}`).expect(t, http.StatusOK).decode(t, &patched)
+	if gotXmin, gotEvents := rowState(t, s, user.ID); patched.Version != 2 || gotXmin == xmin || gotEvents != events+1 {
+		t.Fatalf("real PATCH: version %d, xmin %s -> %s, events %d -> %d", patched.Version, xmin, gotXmin, events, gotEvents)
+	}
+}
+
+func TestNoopUpdateWritesWhenSkipDisabled(t *testing.T) {
+	s := startServer(t, func(cfg *config.Config) { cfg.SkipNoopUpdates = false })
+	tn := s.newTenant(t, "acme")
+	user := s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+	xmin, events := rowState(t, s, user.ID)
+
+	var patched model.User
+	s.call(t, "PATCH", fmt.Sprintf("/users/%d", user.ID), tn.editor, `{"age":30,"version":1}`).expect(t, http.StatusOK).decode(t, &patched)
+	if gotXmin, gotEvents := rowState(t, s, user.ID); patched.Version != 2 || gotXmin == xmin || gotEvents != events+1 {
+		t.Fatalf("PATCH without skipping: version %d, xmin %s -> %s, events %d -> %d", patched.Version, xmin, gotXmin, events, gotEvents)
+	}
+}
+
+// waitingQueries функция для подсчёта запросов к таблице users, которые ждут блокировку
+func waitingQueries(t *testing.T, s *server) int {
+	t.Helper()
+	var n int
+	_, err := s.db.QueryOne(pg.Scan(&n), `SELECT count(*) FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid() AND wait_event_type = 'Lock' AND query ILIKE '%users%'`)
+	if err != nil {
+		t.Fatalf("read pg_stat_activity: %v", err)
+	}
+	return n
+}
+
+func TestClientDisconnectAbortsQuery(t *testing.T) {
+	s := startServer(t)
+	tn := s.newTenant(t, "acme")
+	s.createUser(t, tn.editor, "Alice", "alice@example.com", 30)
+
+	for _, path := range []string{"/users/export", "/users?page=1"} {
+		t.Run(path, func(t *testing.T) {
+			// Блокировка таблицы держит запрос сервиса в базе, пока клиент не уйдёт
+			tx, err := s.db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			if _, err := tx.Exec("LOCK TABLE users IN ACCESS EXCLUSIVE MODE"); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req := s.newRequest(t, "GET", path, tn.viewer, "").WithContext(ctx)
+			finished := make(chan error, 1)
+			go func() {
+				resp, err := http.DefaultClient.Do(req)
+				if err == nil {
+					resp.Body.Close()
+				}
+				finished <- err
+			}()
+			eventually(t, "the query to wait for the table lock", func() bool { return waitingQueries(t, s) > 0 })
+
+			// Клиент отключается: запрос в базе отменяется, не дожидаясь снятия блокировки
+			cancel()
+			if err := <-finished; err == nil {
+				t.Fatal("request finished before the table was unlocked")
+			}
+			eventually(t, "the query to be cancelled", func() bool { return waitingQueries(t, s) == 0 })
+			if err := tx.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+			s.call(t, "GET", path, tn.viewer, "").expect(t, http.StatusOK)
+		})
+	}
+}
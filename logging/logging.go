@@ -0,0 +1,131 @@
+// Package logging настраивает структурированное логирование сервиса поверх log/slog: уровень и формат
+// из настроек, ID запроса и другие поля из контекста в каждой записи и скрытие секретов.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Redacted значение, которое пишется в лог вместо секрета
+const Redacted = "[REDACTED]"
+
+// contextKey тип ключей контекста пакета
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	attrsKey
+)
+
+// sensitiveKeys имена полей, значения которых никогда не попадают в лог
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"new_password":  true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"cookie":        true,
+	"secret":        true,
+	"jwt_secret":    true,
+}
+
+// Setup функция для настройки логгера по умолчанию: slog и стандартный log пишут в stderr одним форматом.
+// level — debug, info, warn или error; format — text или json
+func Setup(level, format string) error {
+	logger, err := New(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+	// SetDefault перенаправляет и пакет log, поэтому сообщения сторонних библиотек тоже структурированы
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New функция для создания логгера с заданными уровнем и форматом
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	var h slog.Handler
+	switch format {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// StdLogger функция для получения *log.Logger, пишущего через slog с заданным уровнем, для библиотек,
+// которые принимают только его (например http.Server.ErrorLog)
+func StdLogger(level slog.Level) *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), level)
+}
+
+// WithRequestID функция для сохранения ID запроса в контексте; он добавляется ко всем записям с этим контекстом
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID функция для получения ID запроса из контекста
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// With функция для добавления полей ко всем записям, сделанным с этим контекстом, например account_id или job_id
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent, _ := ctx.Value(attrsKey).([]slog.Attr)
+	return context.WithValue(ctx, attrsKey, append(parent[:len(parent):len(parent)], attrs...))
+}
+
+// contextHandler структура-обёртка, добавляющая к записи ID запроса и поля из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		if attrs, ok := ctx.Value(attrsKey).([]slog.Attr); ok {
+			r.AddAttrs(attrs...)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redact функция для замены значений секретных полей на Redacted, в том числе во вложенных группах
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// IsSensitive функция для проверки, что поле с таким именем содержит секрет
+func IsSensitive(key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	return sensitiveKeys[key] || strings.HasSuffix(key, "_password") || strings.HasSuffix(key, "_secret")
+}
@@ -0,0 +1,81 @@
+// Package mailer содержит отправку писем: SMTP и запись в лог для разработки без почтового сервера.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message структура для хранения письма в виде простого текста
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer интерфейс отправки писем
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig структура для хранения параметров SMTP-сервера
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTP реализация Mailer через SMTP-сервер; STARTTLS включается, если сервер его поддерживает
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+// NewSMTP функция для создания отправителя через SMTP
+func NewSMTP(cfg SMTPConfig) *SMTP {
+	return &SMTP{cfg: cfg}
+}
+
+// Send функция для отправки письма; net/smtp не принимает контекст, поэтому отмена не прерывает отправку
+func (m *SMTP) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	if err := smtp.SendMail(addr, auth, m.cfg.From, []string{msg.To}, m.format(msg)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// format функция для сборки письма с заголовками RFC 5322
+func (m *SMTP) format(msg Message) []byte {
+	// Переводы строк в заголовках недопустимы: иначе из адреса или темы можно внедрить свои заголовки
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", clean.Replace(m.cfg.From))
+	fmt.Fprintf(&b, "To: %s\r\n", clean.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", clean.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Log реализация Mailer, которая только пишет письма в лог; используется, когда SMTP не настроен
+type Log struct{}
+
+// Send функция для записи письма в лог. Ссылки в письмах одноразовые, но это всё равно режим разработки:
+// без SMTP токены подтверждения и сброса пароля видны в логе
+func (Log) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,83 @@
+// Package metrics содержит метрики Prometheus: HTTP-запросы и состояние пула соединений go-pg.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics структура для хранения реестра и метрик сервиса
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New функция для создания реестра с метриками HTTP, рантайма Go и процесса
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveRequest функция для учёта завершённого HTTP-запроса; route — шаблон маршрута, а не путь
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.duration.WithLabelValues(route, method, code).Observe(elapsed.Seconds())
+}
+
+// Handler функция для получения обработчика /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDBPool функция для регистрации метрик пула соединений go-pg, значения читаются при каждом сборе
+func (m *Metrics) RegisterDBPool(db *pg.DB) {
+	stat := func(name, help string, value func(*pg.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(db.PoolStats()))
+		})
+	}
+	counter := func(name, help string, value func(*pg.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(db.PoolStats()))
+		})
+	}
+	m.registry.MustRegister(
+		stat("db_pool_total_connections", "Number of connections in the pool.",
+			func(s *pg.PoolStats) uint32 { return s.TotalConns }),
+		stat("db_pool_idle_connections", "Number of idle connections in the pool.",
+			func(s *pg.PoolStats) uint32 { return s.IdleConns }),
+		counter("db_pool_hits_total", "Number of times a free connection was found in the pool.",
+			func(s *pg.PoolStats) uint32 { return s.Hits }),
+		counter("db_pool_misses_total", "Number of times a free connection was not found in the pool.",
+			func(s *pg.PoolStats) uint32 { return s.Misses }),
+		counter("db_pool_timeouts_total", "Number of times a wait for a connection timed out.",
+			func(s *pg.PoolStats) uint32 { return s.Timeouts }),
+		counter("db_pool_stale_connections_total", "Number of stale connections removed from the pool.",
+			func(s *pg.PoolStats) uint32 { return s.StaleConns }),
+	)
+}
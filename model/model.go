@@ -0,0 +1,287 @@
+// Package model содержит сущности, которые хранятся в базе данных и отдаются в API.
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// User структура для хранения информации о пользователе
+type User struct {
+	// Колонка search для полнотекстового поиска вычисляется базой и в модель не читается
+	tableName struct{} `pg:"users,discard_unknown_columns"`
+
+	ID int `json:"id"`
+	// TenantID организация, которой принадлежит пользователь; заполняется хранилищем и в API не отдаётся
+	TenantID int    `json:"-" pg:",notnull"`
+	Name     string `json:"name" validate:"required,min=2,max=100"`
+	Email    string `json:"email" validate:"required,email"`
+	Age      int    `json:"age" validate:"gte=0,lte=130"`
+	// Verified email подтверждён по ссылке из письма; сбрасывается при смене email
+	Verified bool `json:"verified" pg:",use_zero"`
+	// Version номер версии строки, увеличивается при каждом изменении; используется в ETag и If-Match
+	Version int `json:"version" pg:"default:1"`
+	// DeletedAt время мягкого удаления; go-pg сам исключает такие строки из выборок
+	DeletedAt *time.Time `json:"deleted_at,omitempty" pg:",soft_delete"`
+	// Profile профиль пользователя, загружается только по запросу (?include=profile)
+	Profile *Profile `json:"profile,omitempty" pg:"rel:belongs-to"`
+}
+
+// UserSearchHit структура для хранения результата полнотекстового поиска
+type UserSearchHit struct {
+	User User    `json:"user"`
+	Rank float64 `json:"rank"`
+	// Highlight имя и email, где совпавшие слова обёрнуты в <mark>; остальной текст экранирован для HTML
+	Highlight map[string]string `json:"highlight"`
+}
+
+// Profile структура для хранения профиля пользователя; связь один к одному по user_id,
+// при окончательном удалении пользователя профиль удаляется каскадно
+type Profile struct {
+	UserID    int       `json:"user_id" pg:",pk"`
+	Bio       string    `json:"bio" validate:"max=1000" pg:",use_zero"`
+	AvatarURL string    `json:"avatar_url" validate:"omitempty,url,max=2048" pg:",use_zero"`
+	Phone     string    `json:"phone" validate:"omitempty,e164" pg:",use_zero"`
+	Address   string    `json:"address" validate:"max=500" pg:",use_zero"`
+	UpdatedAt time.Time `json:"updated_at" pg:"default:now()"`
+}
+
+// UserPatch структура для частичного обновления пользователя: nil-поля не изменяются
+type UserPatch struct {
+	Name  *string `json:"name" validate:"omitnil,min=2,max=100"`
+	Email *string `json:"email" validate:"omitnil,email"`
+	Age   *int    `json:"age" validate:"omitnil,gte=0,lte=130"`
+	// Version ожидаемая версия, если клиент не передал заголовок If-Match; колонкой не является
+	Version *int `json:"version" validate:"omitnil,gte=1"`
+}
+
+// Apply функция для применения изменений к пользователю, возвращает имена изменённых колонок
+func (p UserPatch) Apply(user *User) []string {
+	var columns []string
+	if p.Name != nil && *p.Name != user.Name {
+		user.Name = *p.Name
+		columns = append(columns, "name")
+	}
+	if p.Email != nil && *p.Email != user.Email {
+		user.Email = *p.Email
+		columns = append(columns, "email")
+	}
+	if p.Age != nil && *p.Age != user.Age {
+		user.Age = *p.Age
+		columns = append(columns, "age")
+	}
+	return columns
+}
+
+// DefaultTenantID организация, в которую перенесены данные, созданные до появления организаций;
+// запросы без X-Tenant и токена относятся к ней
+const DefaultTenantID = 1
+
+// Tenant структура для хранения организации-клиента: пользователи, учётные записи и подписки webhook
+// каждой организации видны только ей
+type Tenant struct {
+	ID int `json:"id"`
+	// Slug короткое имя для заголовка X-Tenant
+	Slug      string    `json:"slug" validate:"required,min=2,max=50,hostname_rfc1123" pg:",unique,notnull"`
+	Name      string    `json:"name" validate:"required,max=200" pg:",notnull"`
+	CreatedAt time.Time `json:"created_at" pg:"default:now()"`
+}
+
+// Роли учётных записей
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+	// RolePending роль учётной записи без доступа к данным: вход возможен, но данных организации
+	// она не видит, пока администратор не назначит ей другую роль
+	RolePending = "pending"
+)
+
+// Account структура для хранения учётной записи с bcrypt-хэшем пароля
+type Account struct {
+	ID int `json:"id"`
+	// TenantID организация учётной записи; токены учётной записи дают доступ только к её пользователям
+	TenantID int    `json:"tenant_id" pg:",notnull"`
+	Username string `json:"username" pg:",unique,notnull"`
+	// Email адрес для восстановления пароля, необязателен
+	Email        string    `json:"email,omitempty"`
+	PasswordHash string    `json:"-" pg:",notnull"`
+	Role         string    `json:"role" pg:",notnull"`
+	CreatedAt    time.Time `json:"created_at" pg:"default:now()"`
+}
+
+// RefreshToken структура для хранения выданного refresh-токена; сам токен не хранится, только его SHA-256
+type RefreshToken struct {
+	ID        int    `json:"id"`
+	AccountID int    `json:"account_id" pg:",notnull"`
+	TokenHash string `json:"-" pg:",unique,notnull"`
+	// SessionID общий для всех токенов, полученных ротацией из одного входа
+	SessionID string     `json:"session_id" pg:",notnull"`
+	ExpiresAt time.Time  `json:"expires_at" pg:",notnull"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" pg:"default:now()"`
+}
+
+// ResetToken структура для хранения токена сброса пароля; как и refresh-токен, хранится только хэш
+type ResetToken struct {
+	ID        int        `json:"id"`
+	AccountID int        `json:"account_id" pg:",notnull"`
+	TokenHash string     `json:"-" pg:",unique,notnull"`
+	ExpiresAt time.Time  `json:"expires_at" pg:",notnull"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" pg:"default:now()"`
+}
+
+// Invite структура для хранения приглашения в организацию; как и токен сброса, хранится только хэш токена.
+// Приглашение одноразовое: по нему создаётся одна учётная запись с ролью Role
+type Invite struct {
+	ID        int    `json:"id"`
+	TenantID  int    `json:"tenant_id" pg:",notnull"`
+	TokenHash string `json:"-" pg:",unique,notnull"`
+	Role      string `json:"role" pg:",notnull"`
+	// Email если задан, регистрироваться по приглашению можно только с этим адресом
+	Email     string `json:"email,omitempty" pg:",use_zero"`
+	CreatedBy *int   `json:"created_by"`
+	// AccountID учётная запись, созданная по приглашению
+	AccountID *int       `json:"account_id"`
+	ExpiresAt time.Time  `json:"expires_at" pg:",notnull"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" pg:"default:now()"`
+}
+
+// Webhook структура для хранения подписки внешнего сервиса на события об изменениях пользователей
+type Webhook struct {
+	ID       int    `json:"id"`
+	TenantID int    `json:"-" pg:",notnull"`
+	URL      string `json:"url" validate:"required,http_url,max=2048" pg:",notnull"`
+	// Secret ключ HMAC-подписи запросов; отдаётся клиенту только при создании
+	Secret string `json:"secret,omitempty" validate:"omitempty,min=16,max=256" pg:",notnull"`
+	// Events типы событий подписки (user.created, user.updated, user.deleted, user.restored); пустой список — все события
+	Events    []string  `json:"events" validate:"dive,oneof=user.created user.updated user.deleted user.restored" pg:",array,use_zero"`
+	Disabled  bool      `json:"disabled" pg:",use_zero"`
+	CreatedAt time.Time `json:"created_at" pg:"default:now()"`
+	UpdatedAt time.Time `json:"updated_at" pg:"default:now()"`
+}
+
+// Состояния доставки webhook
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery структура для хранения доставки события подписчику: очередь повторов и журнал попыток
+type WebhookDelivery struct {
+	ID            int             `json:"id"`
+	WebhookID     int             `json:"webhook_id" pg:",notnull"`
+	EventType     string          `json:"event_type" pg:",notnull"`
+	Payload       json.RawMessage `json:"payload" pg:"type:jsonb,notnull"`
+	Status        string          `json:"status" pg:",notnull"`
+	Attempts      int             `json:"attempts" pg:",use_zero"`
+	ResponseCode  int             `json:"response_code" pg:",use_zero"`
+	LastError     string          `json:"last_error" pg:",use_zero"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" pg:",notnull"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+	CreatedAt     time.Time       `json:"created_at" pg:"default:now()"`
+
+	// Webhook подписка, которой адресована доставка; заполняется при выборке очереди
+	Webhook *Webhook `json:"-" pg:"-"`
+}
+
+// OutboxEvent структура для хранения события об изменении пользователя в outbox до его публикации
+type OutboxEvent struct {
+	ID        int    `json:"id"`
+	EventType string `json:"event_type" pg:",notnull"`
+	TenantID  int    `json:"tenant_id" pg:",notnull"`
+	UserID    int    `json:"user_id" pg:",notnull"`
+	// Payload пользователь после изменения, null для удаления
+	Payload   json.RawMessage `json:"payload" pg:"type:jsonb"`
+	RequestID string          `json:"request_id" pg:",use_zero"`
+	CreatedAt time.Time       `json:"created_at" pg:"default:now()"`
+	// AvailableAt когда событие можно забрать снова; диспетчер откладывает взятое на время публикации
+	AvailableAt time.Time  `json:"available_at" pg:"default:now()"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+// Состояния фоновой задачи
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job структура для хранения фоновой задачи: очередь с повторами и состояние для GET /jobs/{id}
+type Job struct {
+	ID int `json:"id"`
+	// TenantID организация, в пределах которой задача читает и меняет пользователей
+	TenantID int    `json:"-" pg:",notnull"`
+	Type     string `json:"type" pg:",notnull"`
+	// Payload входные данные задачи; клиенту не отдаются, в них бывают адреса и строки импорта
+	Payload     json.RawMessage `json:"-" pg:"type:jsonb,notnull"`
+	Status      string          `json:"status" pg:",notnull"`
+	Attempts    int             `json:"attempts" pg:",use_zero"`
+	MaxAttempts int             `json:"max_attempts" pg:",notnull"`
+	LastError   string          `json:"last_error,omitempty" pg:",use_zero"`
+	// Result итог успешно выполненной задачи, для импорта — отчёт как у синхронного POST /users/bulk
+	Result json.RawMessage `json:"result,omitempty" pg:"type:jsonb"`
+	// AccountID, Actor и RequestID кто и каким запросом поставил задачу; изменения, сделанные задачей,
+	// записываются в журнал от его имени. nil — задача поставлена без входа (например, сброс пароля)
+	AccountID *int   `json:"-"`
+	Actor     string `json:"-" pg:",use_zero"`
+	RequestID string `json:"request_id,omitempty" pg:",use_zero"`
+	// RunAt когда задачу можно взять: время следующей попытки или конец аренды выполняющейся задачи
+	RunAt      time.Time  `json:"run_at" pg:"default:now()"`
+	CreatedAt  time.Time  `json:"created_at" pg:"default:now()"`
+	UpdatedAt  time.Time  `json:"updated_at" pg:"default:now()"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// RevokedToken структура для хранения отозванного access-токена до истечения его срока действия
+type RevokedToken struct {
+	JTI       string    `pg:"jti,pk"`
+	ExpiresAt time.Time `pg:",notnull"`
+}
+
+// LoginAudit структура для хранения записи аудита попытки входа (пароль не сохраняется)
+type LoginAudit struct {
+	ID int `json:"id"`
+	// AccountID и TenantID учётная запись с этим именем и её организация, nil — имя неизвестно
+	AccountID *int      `json:"account_id"`
+	TenantID  *int      `json:"-"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success" pg:",use_zero"`
+	CreatedAt time.Time `json:"created_at" pg:"default:now()"`
+}
+
+// AuditEntityUser имя сущности пользователя в журнале изменений
+const AuditEntityUser = "user"
+
+// AuditEntityProfile имя сущности профиля в журнале изменений; ID записи совпадает с ID пользователя
+const AuditEntityProfile = "profile"
+
+// Действия, которые записываются в журнал изменений
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditLog структура для хранения записи журнала изменений: кто, когда и что изменил
+type AuditLog struct {
+	ID       int    `json:"id"`
+	Entity   string `json:"entity"`
+	EntityID int    `json:"entity_id"`
+	Action   string `json:"action"`
+	// ActorID и Actor учётная запись, выполнившая изменение; nil — изменение не из API
+	ActorID   *int   `json:"actor_id"`
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+	// Before и After состояние записи до и после изменения, null при создании и удалении соответственно
+	Before    json.RawMessage `json:"before" pg:"type:jsonb"`
+	After     json.RawMessage `json:"after" pg:"type:jsonb"`
+	CreatedAt time.Time       `json:"created_at" pg:"default:now()"`
+}
@@ -0,0 +1,84 @@
+// Package ratelimit содержит ограничение частоты запросов по ключу (IP или учётная запись).
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter интерфейс ограничителя частоты запросов; реализация в памяти процесса или во внешнем хранилище (Redis)
+type Limiter interface {
+	// Allow расходует один запрос из лимита ключа. При отказе возвращает, через сколько можно повторить
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// bucket структура для хранения состояния корзины токенов одного ключа
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Memory реализация Limiter на корзинах токенов в памяти процесса; лимиты не разделяются между экземплярами
+type Memory struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// sweepInterval как часто из памяти удаляются корзины неактивных ключей
+const sweepInterval = time.Minute
+
+// NewMemory функция для создания ограничителя: rps запросов в секунду в среднем и до burst подряд
+func NewMemory(rps float64, burst int) *Memory {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Memory{
+		rate:    rps,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow функция для проверки и расхода лимита ключа
+func (m *Memory) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: m.burst, last: now}
+		m.buckets[key] = b
+	}
+	// Корзина пополняется пропорционально прошедшему времени, но не выше burst
+	b.tokens = math.Min(m.burst, b.tokens+now.Sub(b.last).Seconds()*m.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / m.rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep функция для удаления полностью пополнившихся корзин: их состояние не отличается от новой корзины
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	full := time.Duration(m.burst / m.rate * float64(time.Second))
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= full {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// ErrFirstAdmin возвращается при создании администратора в организации, где администраторов ещё нет:
+// первый администратор создаётся только вместе с организацией
+var ErrFirstAdmin = errors.New("the first admin of a tenant can only be created together with the tenant")
+
+// AccountRepository интерфейс хранилища учётных записей
+type AccountRepository interface {
+	// Create сохраняет учётную запись с заданной ролью в организации из контекста; роль не выбирается автоматически,
+	// поэтому параллельные регистрации не могут обе стать администраторами. Администратор создаётся только
+	// в организации, где администратор уже есть, иначе ErrFirstAdmin.
+	// Имена и email учётных записей уникальны во всём сервисе, поэтому вход не требует указывать организацию
+	Create(ctx context.Context, account *model.Account) error
+	Get(ctx context.Context, id int) (*model.Account, error)
+	GetByUsername(ctx context.Context, username string) (*model.Account, error)
+	GetByEmail(ctx context.Context, email string) (*model.Account, error)
+	// UpdateRole меняет роль учётной записи организации из контекста
+	UpdateRole(ctx context.Context, id int, role string) (*model.Account, error)
+	// SetPassword записывает новый хэш пароля и отзывает refresh-токены учётной записи в одной транзакции
+	SetPassword(ctx context.Context, id int, passwordHash string) error
+}
+
+// LoginAuditFilter структура для хранения фильтров журнала попыток входа; пустые поля не фильтруют
+type LoginAuditFilter struct {
+	Username  string
+	AccountID *int
+	IP        string
+	Success   *bool
+	// Since и Until границы времени попытки: Since включительно, Until не включительно
+	Since *time.Time
+	Until *time.Time
+	Limit int
+}
+
+// LoginAuditRepository интерфейс журнала попыток входа
+type LoginAuditRepository interface {
+	Record(ctx context.Context, audit *model.LoginAudit) error
+	// List возвращает попытки входа в учётные записи организации из контекста, новые первыми
+	List(ctx context.Context, filter LoginAuditFilter) ([]model.LoginAudit, error)
+}
+
+// pgAccountRepository реализация AccountRepository поверх go-pg
+type pgAccountRepository struct {
+	db *pg.DB
+}
+
+// pgLoginAuditRepository реализация LoginAuditRepository поверх go-pg
+type pgLoginAuditRepository struct {
+	db *pg.DB
+}
+
+// NewAccountRepository функция для создания хранилища учётных записей в PostgreSQL
+func NewAccountRepository(db *pg.DB) AccountRepository {
+	return &pgAccountRepository{db: db}
+}
+
+// NewLoginAuditRepository функция для создания журнала попыток входа в PostgreSQL
+func NewLoginAuditRepository(db *pg.DB) LoginAuditRepository {
+	return &pgLoginAuditRepository{db: db}
+}
+
+// Create функция для сохранения учётной записи, занятое имя возвращает ErrConflict
+func (r *pgAccountRepository) Create(ctx context.Context, account *model.Account) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if account.Role == "" {
+		return fmt.Errorf("account role is not set")
+	}
+	if account.Role == model.RoleAdmin {
+		hasAdmin, err := r.db.ModelContext(ctx, (*model.Account)(nil)).
+			Where("tenant_id = ?", tenantID).
+			Where("role = ?", model.RoleAdmin).
+			Exists()
+		if err != nil {
+			return err
+		}
+		if !hasAdmin {
+			return ErrFirstAdmin
+		}
+	}
+	account.TenantID = tenantID
+	// ON CONFLICT DO NOTHING не вставляет строку, если имя уже занято
+	res, err := r.db.ModelContext(ctx, account).
+		OnConflict("DO NOTHING").
+		Returning("id").
+		Insert()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		// ON CONFLICT срабатывает на любой уникальный индекс: имени или email
+		return fmt.Errorf("username or email %w", ErrConflict)
+	}
+	return nil
+}
+
+// Get функция для получения учётной записи по ID
+func (r *pgAccountRepository) Get(ctx context.Context, id int) (*model.Account, error) {
+	account := &model.Account{ID: id}
+	err := r.db.ModelContext(ctx, account).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("account")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetByUsername функция для получения учётной записи по имени
+func (r *pgAccountRepository) GetByUsername(ctx context.Context, username string) (*model.Account, error) {
+	account := &model.Account{}
+	err := r.db.ModelContext(ctx, account).Where("username = ?", username).Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("account")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetByEmail функция для получения учётной записи по email без учёта регистра
+func (r *pgAccountRepository) GetByEmail(ctx context.Context, email string) (*model.Account, error) {
+	account := &model.Account{}
+	err := r.db.ModelContext(ctx, account).Where("lower(email) = lower(?)", email).Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("account")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// UpdateRole функция для назначения роли учётной записи
+func (r *pgAccountRepository) UpdateRole(ctx context.Context, id int, role string) (*model.Account, error) {
+	account := &model.Account{ID: id, Role: role}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, account).Column("role").WherePK())
+	if err != nil {
+		return nil, err
+	}
+	res, err := query.Returning("*").Update()
+	if err == pg.ErrNoRows {
+		return nil, notFound("account")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, notFound("account")
+	}
+	return account, nil
+}
+
+// SetPassword функция для смены пароля учётной записи
+func (r *pgAccountRepository) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		res, err := tx.Model(&model.Account{ID: id, PasswordHash: passwordHash}).
+			Column("password_hash").
+			WherePK().
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return notFound("account")
+		}
+		_, err = tx.Model((*model.RefreshToken)(nil)).
+			Set("revoked_at = now()").
+			Where("account_id = ?", id).
+			Where("revoked_at IS NULL").
+			Update()
+		return err
+	})
+}
+
+// Record функция для записи попытки входа в журнал аудита
+func (r *pgLoginAuditRepository) Record(ctx context.Context, audit *model.LoginAudit) error {
+	_, err := r.db.ModelContext(ctx, audit).Insert()
+	return err
+}
+
+// List функция для получения журнала попыток входа организации с фильтрами
+func (r *pgLoginAuditRepository) List(ctx context.Context, filter LoginAuditFilter) ([]model.LoginAudit, error) {
+	var audits []model.LoginAudit
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, &audits))
+	if err != nil {
+		return nil, err
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.AccountID != nil {
+		query = query.Where("account_id = ?", *filter.AccountID)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	err = query.Order("created_at DESC", "id DESC").Limit(filter.Limit).Select()
+	return audits, err
+}
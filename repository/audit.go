@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+
+	"laba8/model"
+)
+
+// Actor структура для хранения сведений о том, кто выполняет изменение, для журнала изменений
+type Actor struct {
+	AccountID int
+	Username  string
+	RequestID string
+}
+
+// actorKey ключ, под которым в контексте хранится Actor
+type actorKey struct{}
+
+// WithActor функция для передачи автора изменений в контексте запроса
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext функция для получения автора изменений; без него запись журнала остаётся без автора
+func actorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
+
+// AuditRepository интерфейс журнала изменений
+type AuditRepository interface {
+	// ListByEntity возвращает историю изменений записи с данным ID в любой из сущностей в порядке выполнения
+	ListByEntity(ctx context.Context, id int, entities ...string) ([]model.AuditLog, error)
+}
+
+// pgAuditRepository реализация AuditRepository поверх go-pg
+type pgAuditRepository struct {
+	db *pg.DB
+}
+
+// NewAuditRepository функция для создания журнала изменений в PostgreSQL
+func NewAuditRepository(db *pg.DB) AuditRepository {
+	return &pgAuditRepository{db: db}
+}
+
+// ListByEntity функция для получения истории изменений записи
+func (r *pgAuditRepository) ListByEntity(ctx context.Context, id int, entities ...string) ([]model.AuditLog, error) {
+	var logs []model.AuditLog
+	err := r.db.ModelContext(ctx, &logs).
+		WhereIn("entity IN (?)", entities).
+		Where("entity_id = ?", id).
+		Order("id ASC").
+		Select()
+	return logs, err
+}
+
+// recordAudit функция для записи изменения в журнал; вызывается в той же транзакции, что и само изменение,
+// поэтому изменение без записи в журнале не сохраняется. Отсутствующее состояние передаётся как nil
+func recordAudit(ctx context.Context, db orm.DB, entity string, action string, id int, before, after interface{}) error {
+	entry := &model.AuditLog{Entity: entity, EntityID: id, Action: action}
+	if actor, ok := actorFromContext(ctx); ok {
+		entry.ActorID = &actor.AccountID
+		entry.Actor = actor.Username
+		entry.RequestID = actor.RequestID
+	}
+	var err error
+	// nil-состояние остаётся пустым и сохраняется как NULL
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	_, err = db.ModelContext(ctx, entry).Insert()
+	return err
+}
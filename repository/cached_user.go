@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"laba8/cache"
+	"laba8/model"
+)
+
+// cachedUserRepository реализация UserRepository, которая кэширует чтение пользователя по ID
+// и сбрасывает запись кэша при каждом изменении. Остальные методы уходят в базу без изменений
+type cachedUserRepository struct {
+	UserRepository
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// NewCachedUserRepository функция для оборачивания хранилища пользователей кэшем.
+// Сброс идёт после записи в базу, поэтому параллельное чтение может вернуть в кэш старую версию:
+// ttl ограничивает, как долго она там пробудет
+func NewCachedUserRepository(repo UserRepository, c cache.Cache, ttl time.Duration) UserRepository {
+	return &cachedUserRepository{UserRepository: repo, cache: c, ttl: ttl}
+}
+
+// userCacheKey функция для построения ключа кэша пользователя; организация входит в ключ, чтобы запись
+// одной организации не отдавалась по тому же ID другой
+func userCacheKey(tenantID, id int) string {
+	return "user:" + strconv.Itoa(tenantID) + ":" + strconv.Itoa(id)
+}
+
+// Get функция для получения пользователя из кэша или базы. Кэшируется только обычное чтение:
+// без удалённых и без профиля, который меняется отдельно от пользователя
+func (r *cachedUserRepository) Get(ctx context.Context, id int, opts GetOptions) (*model.User, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil || opts != (GetOptions{}) {
+		return r.UserRepository.Get(ctx, id, opts)
+	}
+	key := userCacheKey(tenantID, id)
+	data, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "User cache read failed", "key", key, "err", err)
+	}
+	if ok {
+		var user model.User
+		if err := json.Unmarshal(data, &user); err == nil {
+			// Организация в JSON не попадает и восстанавливается из ключа
+			user.TenantID = tenantID
+			return &user, nil
+		}
+	}
+
+	user, err := r.UserRepository.Get(ctx, id, opts)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(user); err == nil {
+		if err := r.cache.Set(ctx, key, data, r.ttl); err != nil {
+			slog.WarnContext(ctx, "User cache write failed", "key", key, "err", err)
+		}
+	}
+	return user, nil
+}
+
+// Create функция для создания пользователя; ключ сбрасывается на случай, если ID выдан повторно
+// (например, после TRUNCATE ... RESTART IDENTITY)
+func (r *cachedUserRepository) Create(ctx context.Context, user *model.User) error {
+	err := r.UserRepository.Create(ctx, user)
+	if err == nil {
+		r.invalidate(ctx, user.ID)
+	}
+	return err
+}
+
+// CreateMany функция для пакетного создания пользователей со сбросом ключей сохранённых строк
+func (r *cachedUserRepository) CreateMany(ctx context.Context, users []*model.User, atomic bool) ([]error, error) {
+	rowErrs, err := r.UserRepository.CreateMany(ctx, users, atomic)
+	if err == nil {
+		var ids []int
+		for i, user := range users {
+			if i < len(rowErrs) && rowErrs[i] == nil {
+				ids = append(ids, user.ID)
+			}
+		}
+		r.invalidate(ctx, ids...)
+	}
+	return rowErrs, err
+}
+
+// Update функция для замены пользователя со сбросом кэша.
+// Кэш сбрасывается и при ошибке: запись могла успеть закоммититься до обрыва соединения
+func (r *cachedUserRepository) Update(ctx context.Context, user *model.User, version int) error {
+	err := r.UserRepository.Update(ctx, user, version)
+	r.invalidate(ctx, user.ID)
+	return err
+}
+
+// Patch функция для частичного изменения пользователя со сбросом кэша
+func (r *cachedUserRepository) Patch(ctx context.Context, id int, patch model.UserPatch, version int) (*model.User, error) {
+	user, err := r.UserRepository.Patch(ctx, id, patch, version)
+	r.invalidate(ctx, id)
+	return user, err
+}
+
+// Delete функция для мягкого удаления пользователя со сбросом кэша
+func (r *cachedUserRepository) Delete(ctx context.Context, id int) error {
+	err := r.UserRepository.Delete(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// Restore функция для восстановления пользователя со сбросом кэша
+func (r *cachedUserRepository) Restore(ctx context.Context, id int) (*model.User, error) {
+	user, err := r.UserRepository.Restore(ctx, id)
+	r.invalidate(ctx, id)
+	return user, err
+}
+
+// MarkVerified функция для подтверждения email со сбросом кэша
+func (r *cachedUserRepository) MarkVerified(ctx context.Context, id int, email string) (*model.User, error) {
+	user, err := r.UserRepository.MarkVerified(ctx, id, email)
+	r.invalidate(ctx, id)
+	return user, err
+}
+
+// invalidate функция для сброса ключей пользователей. Сброс не зависит от отмены запроса:
+// иначе изменение, уже записанное в базу, оставило бы в кэше старую версию
+func (r *cachedUserRepository) invalidate(ctx context.Context, ids ...int) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil || len(ids) == 0 {
+		// Без организации хранилище ничего не изменило
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userCacheKey(tenantID, id)
+	}
+	if err := r.cache.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+		slog.ErrorContext(ctx, "User cache invalidation failed", "keys", keys, "err", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Package repository содержит доступ к PostgreSQL через go-pg.
+// Остальной код работает с хранилищем только через интерфейсы этого пакета.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/config"
+)
+
+// ErrNotFound возвращается, когда запись не найдена; репозитории дополняют его именем сущности
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict возвращается при нарушении уникальности
+var ErrConflict = errors.New("already exists")
+
+// ErrVersionMismatch возвращается, когда запись изменили после того, как клиент прочитал её версию
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrQueryTooExpensive возвращается, когда оценочная стоимость запроса выше допустимой
+var ErrQueryTooExpensive = errors.New("query is too expensive, use more selective filters or a smaller page")
+
+// Connect функция для подключения к базе данных по настройкам сервиса
+func Connect(cfg *config.Config) (*pg.DB, error) {
+	opt, err := pg.ParseURL(cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+
+	// Размер пула по закону Литтла: ожидаемый QPS * средняя задержка запроса
+	if qps := cfg.ExpectedQPS; qps > 0 {
+		latency := time.Duration(cfg.AvgQueryLatencyMS) * time.Millisecond
+		size := PoolSize(qps, latency, cfg.MaxPoolSize)
+		opt.PoolSize = size
+		// Соединения открываются заранее, чтобы первые запросы не ждали подключения
+		opt.MinIdleConns = size
+		slog.Info("Computed pool size", "size", size, "qps", qps, "avg_latency", latency)
+	}
+
+	db := pg.Connect(opt)
+	if cfg.LogLevel == "debug" {
+		db.AddQueryHook(queryLogger{})
+	}
+	slog.Info("Connection to the database successful")
+	return db, nil
+}
+
+// PoolSize функция для расчёта размера пула соединений с ограничением сверху
+func PoolSize(qps float64, latency time.Duration, max int) int {
+	size := int(math.Ceil(qps * latency.Seconds()))
+	if size < 1 {
+		size = 1
+	}
+	if max > 0 && size > max {
+		size = max
+	}
+	return size
+}
+
+// queryLogger структура для логирования SQL-запросов на уровне debug; к записи добавляется ID запроса API,
+// если запрос к базе выполнен с его контекстом
+type queryLogger struct{}
+
+func (queryLogger) BeforeQuery(ctx context.Context, q *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (queryLogger) AfterQuery(ctx context.Context, q *pg.QueryEvent) error {
+	query, err := q.FormattedQuery()
+	if err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "SQL", "duration", time.Since(q.StartTime), "query", string(query))
+	return nil
+}
+
+// IsTransient функция для определения временных ошибок базы данных, после которых клиенту стоит повторить запрос
+func IsTransient(err error) bool {
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		// 08 — ошибки соединения, 53300 — слишком много подключений, 57P01/57P03 — сервер перезапускается
+		return strings.HasPrefix(code, "08") || code == "53300" || code == "57P01" || code == "57P03"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// Ошибка таймаута пула объявлена во внутреннем пакете go-pg, поэтому сравнивается по тексту
+	return err.Error() == "pg: connection pool timeout"
+}
+
+// isUniqueViolation функция для проверки нарушения указанного уникального индекса (SQLSTATE 23505)
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr pg.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505" && pgErr.Field('n') == constraint
+}
+
+// notFound функция для ошибки ErrNotFound с именем сущности
+func notFound(entity string) error {
+	return fmt.Errorf("%s %w", entity, ErrNotFound)
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// ErrInviteInvalid возвращается для неизвестного, просроченного или уже использованного приглашения
+var ErrInviteInvalid = errors.New("invite is invalid or expired")
+
+// InviteRepository интерфейс хранилища приглашений в организацию
+type InviteRepository interface {
+	// Create сохраняет приглашение в организацию из контекста; автором записывается учётная запись из контекста
+	Create(ctx context.Context, invite *model.Invite) error
+	// Redeem в одной транзакции гасит приглашение и создаёт по нему учётную запись в организации и с ролью
+	// приглашения. Негодное приглашение возвращает ErrInviteInvalid, занятое имя или email — ErrConflict;
+	// в обоих случаях приглашение остаётся неиспользованным
+	Redeem(ctx context.Context, tokenHash string, account *model.Account) error
+}
+
+// pgInviteRepository реализация InviteRepository поверх go-pg
+type pgInviteRepository struct {
+	db *pg.DB
+}
+
+// NewInviteRepository функция для создания хранилища приглашений в PostgreSQL
+func NewInviteRepository(db *pg.DB) InviteRepository {
+	return &pgInviteRepository{db: db}
+}
+
+// Create функция для сохранения приглашения
+func (r *pgInviteRepository) Create(ctx context.Context, invite *model.Invite) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	invite.TenantID = tenantID
+	if actor, ok := actorFromContext(ctx); ok && actor.AccountID > 0 {
+		invite.CreatedBy = &actor.AccountID
+	}
+	_, err = r.db.ModelContext(ctx, invite).Returning("id, created_at").Insert()
+	return err
+}
+
+// Redeem функция для регистрации учётной записи по приглашению
+func (r *pgInviteRepository) Redeem(ctx context.Context, tokenHash string, account *model.Account) error {
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Условие на used_at гасит приглашение ровно один раз даже при параллельных регистрациях
+		invite := &model.Invite{}
+		_, err := tx.Model(invite).
+			Set("used_at = now()").
+			Where("token_hash = ?", tokenHash).
+			Where("used_at IS NULL").
+			Where("expires_at > now()").
+			Returning("*").
+			Update()
+		if err == pg.ErrNoRows {
+			return ErrInviteInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if invite.Email != "" {
+			if account.Email == "" {
+				account.Email = invite.Email
+			} else if !strings.EqualFold(account.Email, invite.Email) {
+				return fmt.Errorf("%w: it was issued for another email", ErrInviteInvalid)
+			}
+		}
+		account.TenantID = invite.TenantID
+		account.Role = invite.Role
+		res, err := tx.Model(account).OnConflict("DO NOTHING").Returning("id").Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("username or email %w", ErrConflict)
+		}
+		_, err = tx.Model(invite).Set("account_id = ?", account.ID).WherePK().Update()
+		return err
+	})
+}
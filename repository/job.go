@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// JobRepository интерфейс хранилища фоновых задач
+type JobRepository interface {
+	// Create ставит задачу в очередь; организация и автор берутся из контекста запроса, как для журнала изменений
+	Create(ctx context.Context, job *model.Job) error
+	// Get возвращает задачу организации из контекста
+	Get(ctx context.Context, id int) (*model.Job, error)
+	// ClaimDue забирает до limit задач, срок которых наступил, переводит их в running и засчитывает попытку.
+	// Задача остаётся за обработчиком на lease; если он не записал итог, её возьмут снова
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.Job, error)
+	// Record сохраняет итог попытки
+	Record(ctx context.Context, job *model.Job) error
+	// Purge удаляет завершённые задачи старше before и возвращает их число
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// pgJobRepository реализация JobRepository поверх go-pg
+type pgJobRepository struct {
+	db *pg.DB
+}
+
+// NewJobRepository функция для создания хранилища задач в PostgreSQL
+func NewJobRepository(db *pg.DB) JobRepository {
+	return &pgJobRepository{db: db}
+}
+
+// Create функция для сохранения новой задачи
+func (r *pgJobRepository) Create(ctx context.Context, job *model.Job) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	job.TenantID = tenantID
+	if actor, ok := actorFromContext(ctx); ok {
+		job.AccountID = &actor.AccountID
+		job.Actor = actor.Username
+		job.RequestID = actor.RequestID
+	}
+	job.Status = model.JobQueued
+	_, err = r.db.ModelContext(ctx, job).Returning("*").Insert()
+	return err
+}
+
+// Get функция для получения задачи по ID
+func (r *pgJobRepository) Get(ctx context.Context, id int) (*model.Job, error) {
+	job := &model.Job{ID: id}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, job).WherePK())
+	if err != nil {
+		return nil, err
+	}
+	err = query.Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("job")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ClaimDue функция для выборки задач к выполнению; SKIP LOCKED позволяет нескольким экземплярам
+// сервиса разбирать очередь, не мешая друг другу. Running с истёкшей арендой — задача упавшего обработчика
+func (r *pgJobRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.Job, error) {
+	var jobs []model.Job
+	_, err := r.db.QueryContext(ctx, &jobs, `
+		UPDATE jobs SET status = ?, attempts = attempts + 1, updated_at = now(),
+			run_at = now() + ?::interval
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status IN (?, ?) AND run_at <= now()
+			ORDER BY run_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		model.JobRunning, fmt.Sprintf("%d milliseconds", lease.Milliseconds()),
+		model.JobQueued, model.JobRunning, limit)
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Record функция для сохранения итога попытки
+func (r *pgJobRepository) Record(ctx context.Context, job *model.Job) error {
+	job.UpdatedAt = time.Now()
+	_, err := r.db.ModelContext(ctx, job).
+		Column("status", "attempts", "last_error", "result", "run_at", "updated_at", "finished_at").
+		WherePK().
+		Update()
+	return err
+}
+
+// Purge функция для удаления давно завершённых задач
+func (r *pgJobRepository) Purge(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ModelContext(ctx, (*model.Job)(nil)).
+		Where("status IN (?, ?)", model.JobSucceeded, model.JobFailed).
+		Where("finished_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"embed"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-pg/migrations/v8"
+	"github.com/go-pg/pg/v10"
+)
+
+// migrationFiles версионированные SQL-миграции вида <версия>_<описание>.tx.up.sql / .tx.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID ключ advisory-блокировки, под которой выполняются миграции
+const migrationLockID = 8008
+
+// newMigrations функция для загрузки коллекции миграций из встроенных файлов
+func newMigrations() (*migrations.Collection, error) {
+	c := migrations.NewCollection().DisableSQLAutodiscover(true)
+	if err := c.DiscoverSQLMigrationsFromFilesystem(http.FS(migrationFiles), "migrations"); err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return c, nil
+}
+
+// Migrate функция для выполнения команды миграций: up [версия], down, reset, version, set_version <версия>.
+// Одновременно запущенные экземпляры ждут, пока первый закончит
+func Migrate(db *pg.DB, args ...string) (oldVersion, newVersion int64, err error) {
+	c, err := newMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Advisory-блокировка действует в рамках сессии, поэтому нужно одно соединение
+	conn := db.Conn()
+	defer conn.Close()
+
+	if _, err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID); err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if _, err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID); err != nil {
+			slog.Error("Failed to release migration lock", "err", err)
+		}
+	}()
+
+	// Таблица версий создаётся с IF NOT EXISTS, поэтому init безопасно выполнять каждый раз
+	if _, _, err := c.Run(conn, "init"); err != nil {
+		return 0, 0, err
+	}
+	return c.Run(conn, args...)
+}
+
+// MigrationStatus функция для получения текущей версии схемы и версии последней миграции
+func MigrationStatus(db *pg.DB) (current, latest int64, err error) {
+	c, err := newMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if ms := c.Migrations(); len(ms) > 0 {
+		latest = ms[len(ms)-1].Version
+	}
+	if _, _, err := c.Run(db, "init"); err != nil {
+		return 0, 0, err
+	}
+	current, err = c.Version(db)
+	return current, latest, err
+}
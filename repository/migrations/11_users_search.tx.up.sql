@@ -0,0 +1,10 @@
+-- Полнотекстовый поиск по имени и email. Колонка вычисляется самой базой при каждой записи;
+-- email дополнительно разбивается по знакам препинания, чтобы находиться по логину и домену.
+-- Конфигурация simple: имена и адреса не нужно приводить к основе слова
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(email, '')), 'B') ||
+    setweight(to_tsvector('simple', translate(coalesce(email, ''), '@.-_+', '     ')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_idx ON users USING gin (search);
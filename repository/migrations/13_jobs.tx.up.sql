@@ -0,0 +1,21 @@
+-- Фоновые задачи: письма и импорт пользователей. Очередь в базе переживает перезапуск сервиса
+-- и разбирается несколькими экземплярами через SKIP LOCKED
+CREATE TABLE IF NOT EXISTS jobs (
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    result jsonb,
+    account_id bigint REFERENCES accounts (id) ON DELETE SET NULL,
+    actor text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    run_at timestamptz NOT NULL DEFAULT now(),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at) WHERE status IN ('queued', 'running');
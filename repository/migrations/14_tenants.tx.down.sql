@@ -0,0 +1,11 @@
+-- Одинаковые email в разных организациях нарушат общий уникальный индекс; их нужно устранить до отката
+DROP INDEX IF EXISTS users_email_unique_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email)) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS webhooks_tenant_idx;
+DROP INDEX IF EXISTS users_tenant_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhooks DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE accounts DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
+DROP TABLE IF EXISTS tenants;
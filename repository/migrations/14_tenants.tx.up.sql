@@ -0,0 +1,31 @@
+-- Организации-клиенты. Существующие данные переходят в организацию default с ID 1
+CREATE TABLE IF NOT EXISTS tenants (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default') ON CONFLICT DO NOTHING;
+SELECT setval(pg_get_serial_sequence('tenants', 'id'), (SELECT max(id) FROM tenants));
+
+-- Значение по умолчанию нужно только для уже существующих строк и сразу снимается:
+-- вставка без организации должна падать, а не попадать в default
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+ALTER TABLE accounts ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+ALTER TABLE webhooks ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1;
+ALTER TABLE outbox_events ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+ALTER TABLE jobs ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Все выборки пользователей идут в пределах организации
+CREATE INDEX IF NOT EXISTS users_tenant_idx ON users (tenant_id, id);
+CREATE INDEX IF NOT EXISTS webhooks_tenant_idx ON webhooks (tenant_id);
+
+-- Email пользователя уникален внутри организации: у разных клиентов могут быть одни и те же люди
+DROP INDEX IF EXISTS users_email_unique_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (tenant_id, lower(email)) WHERE deleted_at IS NULL;
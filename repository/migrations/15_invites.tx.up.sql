@@ -0,0 +1,14 @@
+-- Приглашения в организацию: /register создаёт учётную запись только по приглашению администратора.
+-- Как и у токенов сброса пароля, хранится только хэш токена
+CREATE TABLE IF NOT EXISTS invites (
+    id bigserial PRIMARY KEY,
+    tenant_id bigint NOT NULL REFERENCES tenants (id),
+    token_hash text NOT NULL UNIQUE,
+    role text NOT NULL,
+    email text NOT NULL DEFAULT '',
+    created_by bigint REFERENCES accounts (id) ON DELETE SET NULL,
+    account_id bigint REFERENCES accounts (id) ON DELETE SET NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
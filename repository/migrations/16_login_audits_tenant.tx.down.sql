@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS login_audits_tenant_idx;
+ALTER TABLE login_audits DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE login_audits DROP COLUMN IF EXISTS account_id;
@@ -0,0 +1,9 @@
+-- Журнал входов просматривают администраторы организации: попытка относится к учётной записи и её организации,
+-- если имя известно. Попытки с неизвестным именем остаются без организации. Прежние записи сопоставляются по имени
+ALTER TABLE login_audits ADD COLUMN IF NOT EXISTS account_id bigint REFERENCES accounts (id) ON DELETE SET NULL;
+ALTER TABLE login_audits ADD COLUMN IF NOT EXISTS tenant_id bigint REFERENCES tenants (id);
+UPDATE login_audits la SET account_id = a.id, tenant_id = a.tenant_id
+FROM accounts a
+WHERE a.username = la.username AND la.account_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS login_audits_tenant_idx ON login_audits (tenant_id, created_at DESC);
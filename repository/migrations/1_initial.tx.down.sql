@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS login_audits;
+DROP TABLE IF EXISTS users;
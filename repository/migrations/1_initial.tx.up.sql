@@ -0,0 +1,24 @@
+-- Схема, которую раньше создавал CreateTable; IF NOT EXISTS позволяет применить миграцию к уже существующей базе
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    name text,
+    email text,
+    age bigint
+);
+
+CREATE TABLE IF NOT EXISTS login_audits (
+    id bigserial PRIMARY KEY,
+    username text,
+    ip text,
+    user_agent text,
+    success boolean,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id bigserial PRIMARY KEY,
+    username text NOT NULL UNIQUE,
+    password_hash text NOT NULL,
+    role text NOT NULL DEFAULT 'viewer',
+    created_at timestamptz DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- Email уникален без учёта регистра; при наличии дубликатов их нужно устранить до применения миграции
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email));
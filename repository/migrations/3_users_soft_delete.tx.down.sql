@@ -0,0 +1,5 @@
+-- Мягко удалённые строки удаляются окончательно, иначе они могут нарушить полный уникальный индекс
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS users_email_unique_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email));
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id bigserial PRIMARY KEY,
+    entity text NOT NULL,
+    entity_id bigint NOT NULL,
+    action text NOT NULL,
+    actor_id bigint,
+    actor text,
+    request_id text,
+    before jsonb,
+    after jsonb,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- История одной записи читается по entity и entity_id в порядке изменений
+CREATE INDEX IF NOT EXISTS audit_logs_entity_idx ON audit_logs (entity, entity_id, id);
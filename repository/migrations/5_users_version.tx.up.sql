@@ -0,0 +1,2 @@
+-- Версия строки для оптимистической блокировки: каждое изменение увеличивает её на единицу
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+-- Профиль существует не больше одного на пользователя и удаляется вместе со строкой users. DELETE /users/{id}
+-- только помечает строку deleted_at, поэтому профиль остаётся до восстановления или физического удаления
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id bigint PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    bio text NOT NULL DEFAULT '',
+    avatar_url text NOT NULL DEFAULT '',
+    phone text NOT NULL DEFAULT '',
+    address text NOT NULL DEFAULT '',
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reset_tokens;
+DROP INDEX IF EXISTS accounts_email_unique_idx;
+ALTER TABLE accounts DROP COLUMN IF EXISTS email;
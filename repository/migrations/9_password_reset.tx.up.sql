@@ -0,0 +1,12 @@
+-- Email учётной записи нужен для восстановления пароля; пустой адрес не участвует в уникальности
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email text;
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_email_unique_idx ON accounts (lower(email)) WHERE email IS NOT NULL AND email <> '';
+
+CREATE TABLE IF NOT EXISTS reset_tokens (
+    id bigserial PRIMARY KEY,
+    account_id bigint NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    token_hash text NOT NULL UNIQUE,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT now()
+);
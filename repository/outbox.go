@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+
+	"laba8/model"
+)
+
+// outboxChannel канал LISTEN/NOTIFY, в который триггер сообщает о новых событиях (миграция 12)
+const outboxChannel = "outbox_events"
+
+// OutboxRepository интерфейс outbox событий об изменениях пользователей. События пишет хранилище
+// пользователей в транзакции изменения, здесь — только их разбор
+type OutboxRepository interface {
+	// Claim забирает до limit неопубликованных событий в порядке записи и откладывает их на lease,
+	// чтобы другой экземпляр сервиса не опубликовал их одновременно
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	// MarkPublished отмечает события опубликованными
+	MarkPublished(ctx context.Context, ids []int) error
+	// Release возвращает взятые события в очередь, не дожидаясь конца lease
+	Release(ctx context.Context, ids []int) error
+	// Purge удаляет опубликованные события старше before и возвращает их число
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// Listen подписывается на уведомления о новых событиях; канал закрывается после вызова функции отмены
+	Listen(ctx context.Context) (<-chan struct{}, func())
+}
+
+// pgOutboxRepository реализация OutboxRepository поверх go-pg
+type pgOutboxRepository struct {
+	db *pg.DB
+}
+
+// NewOutboxRepository функция для создания outbox в PostgreSQL
+func NewOutboxRepository(db *pg.DB) OutboxRepository {
+	return &pgOutboxRepository{db: db}
+}
+
+// recordOutbox функция для записи события в outbox в той же транзакции, что и изменение пользователя;
+// user — состояние после изменения, nil для удаления. Организация события — та, в которой выполнено изменение
+func recordOutbox(ctx context.Context, db orm.DB, eventType string, userID int, user *model.User) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	event := &model.OutboxEvent{EventType: eventType, TenantID: tenantID, UserID: userID}
+	if actor, ok := actorFromContext(ctx); ok {
+		event.RequestID = actor.RequestID
+	}
+	if user != nil {
+		payload, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		event.Payload = payload
+	}
+	_, err = db.ModelContext(ctx, event).Insert()
+	return err
+}
+
+// Claim функция для выборки событий к публикации; SKIP LOCKED позволяет нескольким экземплярам
+// разбирать outbox, не мешая друг другу
+func (r *pgOutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	var pending []model.OutboxEvent
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		err := tx.Model(&pending).
+			Where("published_at IS NULL").
+			Where("available_at <= now()").
+			Order("id").
+			Limit(limit).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		ids := make([]int, 0, len(pending))
+		for _, e := range pending {
+			ids = append(ids, e.ID)
+		}
+		_, err = tx.Model((*model.OutboxEvent)(nil)).
+			Set("available_at = now() + ?::interval", fmt.Sprintf("%d milliseconds", lease.Milliseconds())).
+			WhereIn("id IN (?)", ids).
+			Update()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// MarkPublished функция для отметки событий опубликованными
+func (r *pgOutboxRepository) MarkPublished(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.ModelContext(ctx, (*model.OutboxEvent)(nil)).
+		Set("published_at = now()").
+		WhereIn("id IN (?)", ids).
+		Update()
+	return err
+}
+
+// Release функция для снятия lease с неопубликованных событий: следующий Claim снова начнёт с них,
+// и события, записанные позже, их не обгонят
+func (r *pgOutboxRepository) Release(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.ModelContext(ctx, (*model.OutboxEvent)(nil)).
+		Set("available_at = now()").
+		Where("published_at IS NULL").
+		WhereIn("id IN (?)", ids).
+		Update()
+	return err
+}
+
+// Purge функция для удаления давно опубликованных событий, чтобы outbox не рос бесконечно
+func (r *pgOutboxRepository) Purge(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ModelContext(ctx, (*model.OutboxEvent)(nil)).
+		Where("published_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// Listen функция для подписки на NOTIFY от триггера outbox. go-pg сам переподключает слушателя
+// после обрыва соединения; уведомления, пришедшие подряд, сливаются в одно
+func (r *pgOutboxRepository) Listen(ctx context.Context) (<-chan struct{}, func()) {
+	ln := r.db.Listen(ctx, outboxChannel)
+	wake := make(chan struct{}, 1)
+	go func() {
+		defer close(wake)
+		for range ln.Channel() {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return wake, func() { ln.Close() }
+}
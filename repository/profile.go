@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// ProfileRepository интерфейс хранилища профилей пользователей; как и UserRepository, видит только
+// пользователей организации из контекста
+type ProfileRepository interface {
+	// Get возвращает профиль неудалённого пользователя
+	Get(ctx context.Context, userID int) (*model.Profile, error)
+	// Save создаёт или полностью заменяет профиль неудалённого пользователя
+	Save(ctx context.Context, profile *model.Profile) error
+	// SetAvatar записывает ссылку на аватар, создавая пустой профиль при необходимости
+	SetAvatar(ctx context.Context, userID int, url string) (*model.Profile, error)
+}
+
+// pgProfileRepository реализация ProfileRepository поверх go-pg
+type pgProfileRepository struct {
+	db *pg.DB
+}
+
+// NewProfileRepository функция для создания хранилища профилей в PostgreSQL
+func NewProfileRepository(db *pg.DB) ProfileRepository {
+	return &pgProfileRepository{db: db}
+}
+
+// Get функция для получения профиля; у мягко удалённого пользователя профиль не отдаётся
+func (r *pgProfileRepository) Get(ctx context.Context, userID int) (*model.Profile, error) {
+	user := &model.User{ID: userID}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, user).WherePK().Relation("Profile"))
+	if err != nil {
+		return nil, err
+	}
+	err = query.Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Profile == nil {
+		return nil, notFound("profile")
+	}
+	return user.Profile, nil
+}
+
+// Save функция для сохранения профиля целиком; строка пользователя блокируется,
+// чтобы его нельзя было удалить, пока профиль сохраняется
+func (r *pgProfileRepository) Save(ctx context.Context, profile *model.Profile) error {
+	return r.upsert(ctx, profile, "bio = EXCLUDED.bio, avatar_url = EXCLUDED.avatar_url, phone = EXCLUDED.phone, address = EXCLUDED.address")
+}
+
+// SetAvatar функция для записи ссылки на аватар без изменения остальных полей профиля
+func (r *pgProfileRepository) SetAvatar(ctx context.Context, userID int, url string) (*model.Profile, error) {
+	profile := &model.Profile{UserID: userID, AvatarURL: url}
+	if err := r.upsert(ctx, profile, "avatar_url = EXCLUDED.avatar_url"); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// upsert функция для вставки профиля или обновления перечисленных в set колонок существующего;
+// изменение пишется в журнал в той же транзакции
+func (r *pgProfileRepository) upsert(ctx context.Context, profile *model.Profile, set string) error {
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		query, err := scopeTenant(ctx, tx.Model(&model.User{ID: profile.UserID}).WherePK())
+		if err != nil {
+			return err
+		}
+		if err := query.For("SHARE").Select(); err != nil {
+			return err
+		}
+		var before *model.Profile
+		current := &model.Profile{UserID: profile.UserID}
+		err = tx.Model(current).WherePK().For("UPDATE").Select()
+		switch {
+		case err == nil:
+			before = current
+		case err != pg.ErrNoRows:
+			return err
+		}
+		_, err = tx.Model(profile).
+			OnConflict("(user_id) DO UPDATE").
+			Set(set + ", updated_at = now()").
+			Returning("*").
+			Insert()
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return recordAudit(ctx, tx, model.AuditEntityProfile, model.AuditCreate, profile.UserID, nil, profile)
+		}
+		return recordAudit(ctx, tx, model.AuditEntityProfile, model.AuditUpdate, profile.UserID, before, profile)
+	})
+	if err == pg.ErrNoRows {
+		return notFound("user")
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// ErrResetTokenInvalid возвращается для неизвестного, просроченного или уже использованного токена сброса пароля
+var ErrResetTokenInvalid = errors.New("reset token is invalid or expired")
+
+// ResetTokenRepository интерфейс хранилища токенов сброса пароля
+type ResetTokenRepository interface {
+	// Create сохраняет токен; неиспользованные прежние токены учётной записи удаляются
+	Create(ctx context.Context, token *model.ResetToken) error
+	// ResetPassword в одной транзакции гасит токен, записывает новый хэш пароля и отзывает
+	// refresh-токены учётной записи; возвращает ErrResetTokenInvalid для негодного токена
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+}
+
+// pgResetTokenRepository реализация ResetTokenRepository поверх go-pg
+type pgResetTokenRepository struct {
+	db *pg.DB
+}
+
+// NewResetTokenRepository функция для создания хранилища токенов сброса пароля в PostgreSQL
+func NewResetTokenRepository(db *pg.DB) ResetTokenRepository {
+	return &pgResetTokenRepository{db: db}
+}
+
+// Create функция для сохранения токена сброса пароля
+func (r *pgResetTokenRepository) Create(ctx context.Context, token *model.ResetToken) error {
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Действует только последняя выданная ссылка
+		_, err := tx.Model((*model.ResetToken)(nil)).
+			Where("account_id = ?", token.AccountID).
+			Where("used_at IS NULL").
+			Delete()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Model(token).Insert()
+		return err
+	})
+}
+
+// ResetPassword функция для смены пароля по токену
+func (r *pgResetTokenRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	var accountID int
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Условие на used_at гасит токен ровно один раз даже при параллельных запросах
+		token := &model.ResetToken{}
+		_, err := tx.Model(token).
+			Set("used_at = now()").
+			Where("token_hash = ?", tokenHash).
+			Where("used_at IS NULL").
+			Where("expires_at > now()").
+			Returning("account_id").
+			Update()
+		if err == pg.ErrNoRows {
+			return ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		accountID = token.AccountID
+
+		_, err = tx.Model(&model.Account{ID: accountID, PasswordHash: passwordHash}).
+			Column("password_hash").
+			WherePK().
+			Update()
+		if err != nil {
+			return err
+		}
+		// Сессии, открытые до смены пароля, больше не продлеваются
+		_, err = tx.Model((*model.RefreshToken)(nil)).
+			Set("revoked_at = now()").
+			Where("account_id = ?", accountID).
+			Where("revoked_at IS NULL").
+			Update()
+		return err
+	})
+	return accountID, err
+}
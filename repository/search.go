@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// SearchFilter структура для хранения параметров полнотекстового поиска пользователей
+type SearchFilter struct {
+	// TSQuery запрос в синтаксисе to_tsquery; собирается сервисом из проверенных слов
+	TSQuery string
+	// IncludeDeleted включает в поиск мягко удалённых пользователей
+	IncludeDeleted bool
+	Offset         int
+	Limit          int
+}
+
+// Границы совпадений в ts_headline: символы из области частного использования Unicode не встречаются в
+// обычном тексте, поэтому после HTML-экранирования их можно безопасно заменить на теги
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// headlineOptions настройки ts_headline: поля короткие, поэтому показываются целиком
+const headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+
+// searchRow структура для чтения строки результата поиска; inherit сохраняет таблицу и связи User
+type searchRow struct {
+	model.User     `pg:",inherit"`
+	Rank           float64
+	NameHighlight  string
+	EmailHighlight string
+}
+
+// Search функция для полнотекстового поиска по имени и email с ранжированием и подсветкой совпадений.
+// Подсветка строится во внешнем запросе только для строк страницы, а не для всех совпавших
+func (r *pgUserRepository) Search(ctx context.Context, filter SearchFilter) ([]model.UserSearchHit, int, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	deleted := pg.Safe("AND u.deleted_at IS NULL")
+	if filter.IncludeDeleted {
+		deleted = pg.Safe("")
+	}
+
+	var total int
+	_, err = r.db.QueryOneContext(ctx, pg.Scan(&total), `
+		SELECT count(*) FROM users AS u
+		WHERE u.tenant_id = ? AND u.search @@ to_tsquery('simple', ?) ?`,
+		tenantID, filter.TSQuery, deleted)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || filter.Offset >= total {
+		return nil, total, nil
+	}
+
+	var rows []searchRow
+	_, err = r.db.QueryContext(ctx, &rows, `
+		SELECT page.id, page.tenant_id, page.name, page.email, page.age, page.verified, page.version, page.deleted_at, page.rank,
+			ts_headline('simple', page.name, page.q, ?) AS name_highlight,
+			ts_headline('simple', page.email, page.q, ?) AS email_highlight
+		FROM (
+			SELECT u.*, q, ts_rank_cd(u.search, q) AS rank
+			FROM users AS u, to_tsquery('simple', ?) AS q
+			WHERE u.tenant_id = ? AND u.search @@ q ?
+			ORDER BY rank DESC, u.id
+			LIMIT ? OFFSET ?
+		) AS page
+		ORDER BY page.rank DESC, page.id`,
+		headlineOptions, headlineOptions, filter.TSQuery, tenantID, deleted, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]model.UserSearchHit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, model.UserSearchHit{
+			User: row.User,
+			Rank: row.Rank,
+			Highlight: map[string]string{
+				"name":  highlightHTML(row.NameHighlight),
+				"email": highlightHTML(row.EmailHighlight),
+			},
+		})
+	}
+	return hits, total, nil
+}
+
+// highlightHTML функция для экранирования текста подсветки и замены границ совпадений на <mark>
+func highlightHTML(s string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(s))
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+
+	"laba8/model"
+)
+
+// ErrNoTenant возвращается, когда в контексте нет организации: без неё хранилище не выполняет запросы
+// к данным организаций, чтобы ошибка в вызывающем коде не открыла чужие записи
+var ErrNoTenant = errors.New("tenant is not set")
+
+// tenantKey ключ, под которым в контексте хранится ID организации
+type tenantKey struct{}
+
+// WithTenant функция для передачи организации, в пределах которой выполняются запросы к хранилищу
+func WithTenant(ctx context.Context, tenantID int) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// tenantFromContext функция для получения организации запроса; её отсутствие — ошибка, а не «все организации»
+func tenantFromContext(ctx context.Context) (int, error) {
+	id, ok := ctx.Value(tenantKey{}).(int)
+	if !ok || id <= 0 {
+		return 0, ErrNoTenant
+	}
+	return id, nil
+}
+
+// scopeTenant функция для ограничения запроса строками организации из контекста
+func scopeTenant(ctx context.Context, query *orm.Query) (*orm.Query, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where("tenant_id = ?", tenantID), nil
+}
+
+// TenantRepository интерфейс хранилища организаций
+type TenantRepository interface {
+	// Create сохраняет организацию вместе с её первым администратором admin в одной транзакции;
+	// занятый slug, имя или email администратора возвращают ErrConflict, и тогда не создаётся ничего
+	Create(ctx context.Context, tenant *model.Tenant, admin *model.Account) error
+	Get(ctx context.Context, id int) (*model.Tenant, error)
+	GetBySlug(ctx context.Context, slug string) (*model.Tenant, error)
+	List(ctx context.Context) ([]model.Tenant, error)
+}
+
+// pgTenantRepository реализация TenantRepository поверх go-pg
+type pgTenantRepository struct {
+	db *pg.DB
+}
+
+// NewTenantRepository функция для создания хранилища организаций в PostgreSQL
+func NewTenantRepository(db *pg.DB) TenantRepository {
+	return &pgTenantRepository{db: db}
+}
+
+// Create функция для сохранения новой организации и её первого администратора
+func (r *pgTenantRepository) Create(ctx context.Context, tenant *model.Tenant, admin *model.Account) error {
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		res, err := tx.Model(tenant).OnConflict("DO NOTHING").Returning("*").Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("tenant with this slug %w", ErrConflict)
+		}
+		admin.TenantID = tenant.ID
+		admin.Role = model.RoleAdmin
+		res, err = tx.Model(admin).OnConflict("DO NOTHING").Returning("id").Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("admin username or email %w", ErrConflict)
+		}
+		return nil
+	})
+}
+
+// Get функция для получения организации по ID
+func (r *pgTenantRepository) Get(ctx context.Context, id int) (*model.Tenant, error) {
+	tenant := &model.Tenant{ID: id}
+	err := r.db.ModelContext(ctx, tenant).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("tenant")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// GetBySlug функция для получения организации по короткому имени
+func (r *pgTenantRepository) GetBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
+	tenant := &model.Tenant{}
+	err := r.db.ModelContext(ctx, tenant).Where("slug = ?", slug).Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("tenant")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// List функция для получения всех организаций
+func (r *pgTenantRepository) List(ctx context.Context) ([]model.Tenant, error) {
+	var tenants []model.Tenant
+	err := r.db.ModelContext(ctx, &tenants).Order("id").Select()
+	return tenants, err
+}
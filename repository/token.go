@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// TokenRepository интерфейс хранилища refresh-токенов и списка отозванных access-токенов
+type TokenRepository interface {
+	CreateRefresh(ctx context.Context, token *model.RefreshToken) error
+	GetRefreshByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	// RevokeRefresh отзывает токен и возвращает false, если его уже отозвали раньше
+	RevokeRefresh(ctx context.Context, id int) (bool, error)
+	// RevokeSession отзывает все refresh-токены сессии
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeAccess(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// pgTokenRepository реализация TokenRepository поверх go-pg
+type pgTokenRepository struct {
+	db *pg.DB
+}
+
+// NewTokenRepository функция для создания хранилища токенов в PostgreSQL
+func NewTokenRepository(db *pg.DB) TokenRepository {
+	return &pgTokenRepository{db: db}
+}
+
+// CreateRefresh функция для сохранения выданного refresh-токена
+func (r *pgTokenRepository) CreateRefresh(ctx context.Context, token *model.RefreshToken) error {
+	_, err := r.db.ModelContext(ctx, token).Insert()
+	return err
+}
+
+// GetRefreshByHash функция для поиска refresh-токена по хэшу
+func (r *pgTokenRepository) GetRefreshByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	token := &model.RefreshToken{}
+	err := r.db.ModelContext(ctx, token).Where("token_hash = ?", hash).Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("refresh token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RevokeRefresh функция для отзыва refresh-токена; условие на revoked_at не даёт двум запросам использовать его дважды
+func (r *pgTokenRepository) RevokeRefresh(ctx context.Context, id int) (bool, error) {
+	res, err := r.db.ModelContext(ctx, (*model.RefreshToken)(nil)).
+		Set("revoked_at = now()").
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// RevokeSession функция для отзыва всех ещё действующих refresh-токенов сессии
+func (r *pgTokenRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := r.db.ModelContext(ctx, (*model.RefreshToken)(nil)).
+		Set("revoked_at = now()").
+		Where("session_id = ?", sessionID).
+		Where("revoked_at IS NULL").
+		Update()
+	return err
+}
+
+// RevokeAccess функция для внесения access-токена в список отозванных; заодно удаляются записи с истёкшим сроком
+func (r *pgTokenRepository) RevokeAccess(ctx context.Context, jti string, expiresAt time.Time) error {
+	revoked := &model.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	if _, err := r.db.ModelContext(ctx, revoked).OnConflict("DO NOTHING").Insert(); err != nil {
+		return err
+	}
+	_, err := r.db.ModelContext(ctx, (*model.RevokedToken)(nil)).Where("expires_at < now()").Delete()
+	return err
+}
+
+// IsAccessRevoked функция для проверки, отозван ли access-токен
+func (r *pgTokenRepository) IsAccessRevoked(ctx context.Context, jti string) (bool, error) {
+	return r.db.ModelContext(ctx, (*model.RevokedToken)(nil)).Where("jti = ?", jti).Exists()
+}
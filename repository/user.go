@@ -0,0 +1,596 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+
+	"laba8/events"
+	"laba8/model"
+)
+
+// SortField структура для хранения одного поля сортировки
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// UserFilter структура для хранения параметров выборки списка пользователей
+type UserFilter struct {
+	Name string
+	// NameLike поиск по части имени без учёта регистра
+	NameLike string
+	// Age фильтр по точному возрасту, nil — без фильтра
+	Age *int
+	// AgeGte и AgeLte границы диапазона возраста включительно, nil — без границы
+	AgeGte *int
+	AgeLte *int
+	// Verified фильтр по подтверждению email, nil — без фильтра
+	Verified *bool
+	// Sort поля сортировки; имена колонок должны быть проверены по белому списку
+	Sort []SortField
+	// IncludeDeleted включает в выборку мягко удалённых пользователей
+	IncludeDeleted bool
+	// MaxID граница снимка, nil — без ограничения
+	MaxID *int
+	// AfterID id последней строки предыдущей страницы для ListAfter, nil — первая страница
+	AfterID *int
+	Offset  int
+	Limit   int
+}
+
+// GetOptions структура для хранения параметров получения одного пользователя
+type GetOptions struct {
+	// IncludeDeleted находит и мягко удалённого пользователя
+	IncludeDeleted bool
+	// WithProfile загружает профиль пользователя одним запросом с JOIN
+	WithProfile bool
+}
+
+// UserRepository интерфейс хранилища пользователей. Все методы работают только с пользователями
+// организации из контекста (WithTenant); без неё возвращается ErrNoTenant
+type UserRepository interface {
+	// List возвращает страницу пользователей и общее число записей, подходящих под фильтр
+	List(ctx context.Context, filter UserFilter) ([]model.User, int, error)
+	// Each передаёт всех пользователей, подходящих под фильтр, порциями по batchSize; Offset и Limit не учитываются
+	Each(ctx context.Context, filter UserFilter, batchSize int, fn func([]model.User) error) error
+	// ListAfter возвращает до Limit пользователей, идущих после AfterID в порядке id (Sort — только по id),
+	// без подсчёта общего числа; Offset не учитывается
+	ListAfter(ctx context.Context, filter UserFilter) ([]model.User, error)
+	MaxID(ctx context.Context) (int, error)
+	Get(ctx context.Context, id int, opts GetOptions) (*model.User, error)
+	Create(ctx context.Context, user *model.User) error
+	// CreateMany сохраняет пользователей в одной транзакции и возвращает ошибки по строкам (nil — строка сохранена).
+	// В режиме atomic при любой ошибке транзакция откатывается и не сохраняется ни одна строка
+	CreateMany(ctx context.Context, users []*model.User, atomic bool) ([]error, error)
+	// Update и Patch изменяют пользователя, только если его текущая версия равна version (0 — без проверки);
+	// иначе возвращается ErrVersionMismatch
+	Update(ctx context.Context, user *model.User, version int) error
+	Patch(ctx context.Context, id int, patch model.UserPatch, version int) (*model.User, error)
+	// Delete мягко удаляет пользователя, Restore снимает отметку об удалении
+	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) (*model.User, error)
+	// MarkVerified подтверждает email пользователя, если он всё ещё равен email; иначе ErrNotFound
+	MarkVerified(ctx context.Context, id int, email string) (*model.User, error)
+	// Search ищет пользователей по имени и email полнотекстовым поиском; возвращает страницу совпадений,
+	// отсортированную по релевантности, и общее число совпадений
+	Search(ctx context.Context, filter SearchFilter) ([]model.UserSearchHit, int, error)
+}
+
+// UserOptions структура для хранения настроек хранилища пользователей
+type UserOptions struct {
+	// CostCeiling потолок оценочной стоимости запроса списка, 0 — проверка выключена
+	CostCeiling float64
+	// SkipNoopUpdates пропускать UPDATE, если новые значения совпадают с сохранёнными
+	SkipNoopUpdates bool
+}
+
+// emailConstraint уникальный индекс по email среди неудалённых пользователей организации (миграции 2, 3 и 14)
+const emailConstraint = "users_email_unique_idx"
+
+// errEmailTaken возвращается при попытке сохранить уже занятый email
+var errEmailTaken = fmt.Errorf("user with this email %w", ErrConflict)
+
+// mapUserError функция для перевода ошибок Postgres в ошибки хранилища пользователей
+func mapUserError(err error) error {
+	if isUniqueViolation(err, emailConstraint) {
+		return errEmailTaken
+	}
+	return err
+}
+
+// pgUserRepository реализация UserRepository поверх go-pg
+type pgUserRepository struct {
+	db   *pg.DB
+	opts UserOptions
+}
+
+// NewUserRepository функция для создания хранилища пользователей в PostgreSQL
+func NewUserRepository(db *pg.DB, opts UserOptions) UserRepository {
+	return &pgUserRepository{db: db, opts: opts}
+}
+
+// List функция для получения списка пользователей с пагинацией и фильтрацией
+func (r *pgUserRepository) List(ctx context.Context, filter UserFilter) ([]model.User, int, error) {
+	var users []model.User
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, &users))
+	if err != nil {
+		return nil, 0, err
+	}
+	query = applyUserFilter(query, filter)
+
+	// Пагинация
+	query = query.Offset(filter.Offset).Limit(filter.Limit)
+
+	if err := r.checkCost(ctx, query); err != nil {
+		return nil, 0, err
+	}
+
+	// Общее число считается тем же запросом без LIMIT/OFFSET
+	total, err := query.SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// ListAfter функция для получения страницы keyset-пагинации: условие по id вместо OFFSET читает по индексу
+// (tenant_id, id) только нужные строки, поэтому дальние страницы не дороже первой
+func (r *pgUserRepository) ListAfter(ctx context.Context, filter UserFilter) ([]model.User, error) {
+	var users []model.User
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, &users))
+	if err != nil {
+		return nil, err
+	}
+	query = applyUserFilter(query, filter)
+	if filter.AfterID != nil {
+		if len(filter.Sort) > 0 && filter.Sort[0].Desc {
+			query = query.Where("id < ?", *filter.AfterID)
+		} else {
+			query = query.Where("id > ?", *filter.AfterID)
+		}
+	}
+	query = query.Limit(filter.Limit)
+
+	if err := r.checkCost(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := query.Select(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// checkCost функция для отказа от запроса, оценочная стоимость которого выше QueryCostCeiling
+func (r *pgUserRepository) checkCost(ctx context.Context, query *orm.Query) error {
+	if r.opts.CostCeiling <= 0 {
+		return nil
+	}
+	cost, err := r.estimateCost(ctx, query)
+	if err != nil {
+		return err
+	}
+	if cost > r.opts.CostCeiling {
+		return ErrQueryTooExpensive
+	}
+	return nil
+}
+
+// applyUserFilter функция для добавления к запросу условий фильтра, границы снимка и сортировки
+func applyUserFilter(query *orm.Query, filter UserFilter) *orm.Query {
+	// Фильтрация по имени и возрасту
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.NameLike != "" {
+		query = query.Where("name ILIKE ?", "%"+escapeLike(filter.NameLike)+"%")
+	}
+	if filter.Age != nil {
+		query = query.Where("age = ?", *filter.Age)
+	}
+	if filter.AgeGte != nil {
+		query = query.Where("age >= ?", *filter.AgeGte)
+	}
+	if filter.AgeLte != nil {
+		query = query.Where("age <= ?", *filter.AgeLte)
+	}
+	if filter.Verified != nil {
+		query = query.Where("verified = ?", *filter.Verified)
+	}
+	if filter.IncludeDeleted {
+		query = query.AllWithDeleted()
+	}
+	// Снимок: страницы одного снимка не сдвигаются при вставке новых строк
+	if filter.MaxID != nil {
+		query = query.Where("id <= ?", *filter.MaxID)
+	}
+
+	// Сортировка; id в конце делает порядок страниц детерминированным
+	sortedByID := false
+	for _, f := range filter.Sort {
+		dir := "ASC"
+		if f.Desc {
+			dir = "DESC"
+		}
+		query = query.OrderExpr("? ?", pg.Ident(f.Column), pg.Safe(dir))
+		sortedByID = sortedByID || f.Column == "id"
+	}
+	if !sortedByID {
+		query = query.Order("id ASC")
+	}
+	return query
+}
+
+// Each функция для потоковой выборки пользователей через курсор Postgres: в памяти держится только одна порция,
+// а все порции читаются из одного снимка транзакции
+func (r *pgUserRepository) Each(ctx context.Context, filter UserFilter, batchSize int, fn func([]model.User) error) error {
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		query, err := scopeTenant(ctx, tx.ModelContext(ctx, &[]model.User{}))
+		if err != nil {
+			return err
+		}
+		sql, err := applyUserFilter(query, filter).AppendQuery(tx.Formatter(), nil)
+		if err != nil {
+			return err
+		}
+		// Курсор закрывается вместе с транзакцией
+		if _, err := tx.ExecContext(ctx, "DECLARE users_export NO SCROLL CURSOR FOR ?", pg.Safe(sql)); err != nil {
+			return err
+		}
+		for {
+			var batch []model.User
+			if _, err := tx.QueryContext(ctx, &batch, "FETCH ? FROM users_export", batchSize); err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// likeEscaper экранирует спецсимволы шаблона LIKE во введённой строке
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike функция для поиска строки как есть, без подстановочных символов
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// estimateCost функция для получения оценочной стоимости запроса через EXPLAIN
+func (r *pgUserRepository) estimateCost(ctx context.Context, query *orm.Query) (float64, error) {
+	sql, err := query.AppendQuery(r.db.Formatter(), nil)
+	if err != nil {
+		return 0, err
+	}
+	var plan string
+	_, err = r.db.QueryOneContext(ctx, pg.Scan(&plan), "EXPLAIN (FORMAT JSON) ?", pg.Safe(sql))
+	if err != nil {
+		return 0, err
+	}
+	var explain []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &explain); err != nil || len(explain) == 0 {
+		return 0, fmt.Errorf("unexpected EXPLAIN output: %s", plan)
+	}
+	return explain[0].Plan.TotalCost, nil
+}
+
+// MaxID функция для получения наибольшего id пользователя организации (граница нового снимка)
+func (r *pgUserRepository) MaxID(ctx context.Context) (int, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var maxID int
+	_, err = r.db.QueryOneContext(ctx, pg.Scan(&maxID), "SELECT COALESCE(MAX(id), 0) FROM users WHERE tenant_id = ?", tenantID)
+	return maxID, err
+}
+
+// Get функция для получения пользователя по ID
+func (r *pgUserRepository) Get(ctx context.Context, id int, opts GetOptions) (*model.User, error) {
+	user := &model.User{ID: id}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, user).WherePK())
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeDeleted {
+		query = query.AllWithDeleted()
+	}
+	if opts.WithProfile {
+		query = query.Relation("Profile")
+	}
+	err = query.Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Create функция для сохранения нового пользователя
+func (r *pgUserRepository) Create(ctx context.Context, user *model.User) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	// Идентификатор выдаёт база, организация берётся только из контекста, отметка об удалении ставится
+	// только через Delete, версия новой строки всегда начальная
+	user.ID = 0
+	user.TenantID = tenantID
+	user.DeletedAt = nil
+	user.Version = 0
+	user.Verified = false
+	err = r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.Model(user).Insert(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditCreate, user.ID, nil, user); err != nil {
+			return err
+		}
+		return recordOutbox(ctx, tx, events.UserCreated, user.ID, user)
+	})
+	return mapUserError(err)
+}
+
+// CreateMany функция для пакетного сохранения пользователей; каждая строка вставляется под своей точкой сохранения,
+// поэтому ошибка одной строки не прерывает транзакцию
+func (r *pgUserRepository) CreateMany(ctx context.Context, users []*model.User, atomic bool) ([]error, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rowErrs := make([]error, len(users))
+	// errRollback откатывает транзакцию в режиме atomic, не считаясь ошибкой выполнения
+	errRollback := errors.New("rollback")
+	err = r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		failed := false
+		for i, user := range users {
+			// Как в Create: id из файла импорта не используется, он занял бы значение впереди последовательности
+			user.ID = 0
+			user.TenantID = tenantID
+			user.DeletedAt = nil
+			user.Version = 0
+			user.Verified = false
+			if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+				return err
+			}
+			if _, err := tx.Model(user).Insert(); err != nil {
+				if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+					return rbErr
+				}
+				rowErrs[i] = mapUserError(err)
+				failed = true
+				continue
+			}
+			if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditCreate, user.ID, nil, user); err != nil {
+				return err
+			}
+			if err := recordOutbox(ctx, tx, events.UserCreated, user.ID, user); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("RELEASE SAVEPOINT import_row"); err != nil {
+				return err
+			}
+		}
+		if atomic && failed {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return nil, err
+	}
+	return rowErrs, nil
+}
+
+// Update функция для обновления пользователя; без изменений UPDATE не выполняется
+func (r *pgUserRepository) Update(ctx context.Context, user *model.User, version int) error {
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Текущая строка загружается под блокировкой, чтобы сравнить её с новыми значениями
+		current := &model.User{ID: user.ID}
+		if err := lockUser(ctx, tx.Model(current).WherePK()); err != nil {
+			return err
+		}
+		if err := checkVersion(current, version); err != nil {
+			return err
+		}
+		// Мягко удалённые строки сюда не попадают, поэтому отметку об удалении PUT не меняет.
+		// Организацию PUT тоже не меняет: пользователя нельзя перенести в другую организацию
+		user.TenantID = current.TenantID
+		user.DeletedAt = current.DeletedAt
+		user.Version = current.Version
+		user.Profile = nil
+		// Подтверждение относится к адресу: новый email нужно подтвердить заново
+		user.Verified = current.Verified && strings.EqualFold(current.Email, user.Email)
+		if r.opts.SkipNoopUpdates && *current == *user {
+			return nil
+		}
+		user.Version++
+		if _, err := tx.Model(user).WherePK().Update(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditUpdate, user.ID, current, user); err != nil {
+			return err
+		}
+		return recordOutbox(ctx, tx, events.UserUpdated, user.ID, user)
+	})
+	if err == pg.ErrNoRows {
+		return notFound("user")
+	}
+	return mapUserError(err)
+}
+
+// Patch функция для частичного обновления: записываются только переданные и действительно изменённые колонки
+func (r *pgUserRepository) Patch(ctx context.Context, id int, patch model.UserPatch, version int) (*model.User, error) {
+	user := &model.User{ID: id}
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := lockUser(ctx, tx.Model(user).WherePK()); err != nil {
+			return err
+		}
+		if err := checkVersion(user, version); err != nil {
+			return err
+		}
+		before := *user
+		columns := patch.Apply(user)
+		if len(columns) == 0 && r.opts.SkipNoopUpdates {
+			return nil
+		}
+		if len(columns) == 0 {
+			// Без пропуска no-op строка всё равно записывается, как и при PUT
+			columns = []string{"name", "email", "age"}
+		}
+		if user.Verified && !strings.EqualFold(before.Email, user.Email) {
+			user.Verified = false
+			columns = append(columns, "verified")
+		}
+		user.Version++
+		columns = append(columns, "version")
+		if _, err := tx.Model(user).Column(columns...).WherePK().Update(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditUpdate, id, &before, user); err != nil {
+			return err
+		}
+		return recordOutbox(ctx, tx, events.UserUpdated, id, user)
+	})
+	if err == pg.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, mapUserError(err)
+	}
+	return user, nil
+}
+
+// Delete функция для мягкого удаления пользователя: строка остаётся в таблице с заполненным deleted_at.
+// Профиль при этом сохраняется и возвращается вместе с пользователем в Restore; ON DELETE CASCADE
+// у profiles срабатывает только при физическом удалении строки users
+func (r *pgUserRepository) Delete(ctx context.Context, id int) error {
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		user := &model.User{ID: id}
+		if err := lockUser(ctx, tx.Model(user).WherePK()); err != nil {
+			return err
+		}
+		before := *user
+		if _, err := tx.Model(user).WherePK().Delete(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditDelete, id, &before, user); err != nil {
+			return err
+		}
+		return recordOutbox(ctx, tx, events.UserDeleted, id, nil)
+	})
+	// Удаление отсутствующего пользователя, как и раньше, не считается ошибкой
+	if err == pg.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// lockUser функция для чтения пользователя организации из контекста под блокировкой строки. Пользователь
+// другой организации не находится, поэтому следующие за чтением изменения по первичному ключу его не затронут
+func lockUser(ctx context.Context, query *orm.Query) error {
+	query, err := scopeTenant(ctx, query)
+	if err != nil {
+		return err
+	}
+	return query.For("UPDATE").Select()
+}
+
+// checkVersion функция для сравнения версии строки с ожидаемой клиентом
+func checkVersion(current *model.User, version int) error {
+	if version != 0 && current.Version != version {
+		return fmt.Errorf("user has version %d, not %d: %w", current.Version, version, ErrVersionMismatch)
+	}
+	return nil
+}
+
+// MarkVerified функция для подтверждения email; повторное подтверждение того же адреса ничего не меняет
+func (r *pgUserRepository) MarkVerified(ctx context.Context, id int, email string) (*model.User, error) {
+	user := &model.User{ID: id}
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := lockUser(ctx, tx.Model(user).WherePK()); err != nil {
+			return err
+		}
+		// Ссылка выдана для прежнего адреса
+		if !strings.EqualFold(user.Email, email) {
+			return pg.ErrNoRows
+		}
+		if user.Verified {
+			return nil
+		}
+		before := *user
+		user.Verified = true
+		user.Version++
+		if _, err := tx.Model(user).Column("verified", "version").WherePK().Update(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditUpdate, id, &before, user); err != nil {
+			return err
+		}
+		return recordOutbox(ctx, tx, events.UserUpdated, id, user)
+	})
+	if err == pg.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// errNotDeleted возвращается при попытке восстановить пользователя, который не удалён
+var errNotDeleted = fmt.Errorf("user is not deleted: %w", ErrConflict)
+
+// Restore функция для восстановления мягко удалённого пользователя
+func (r *pgUserRepository) Restore(ctx context.Context, id int) (*model.User, error) {
+	user := &model.User{ID: id}
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := lockUser(ctx, tx.Model(user).WherePK().Deleted()); err != nil {
+			return err
+		}
+		before := *user
+		if _, err := tx.Model(user).WherePK().Deleted().Set("deleted_at = NULL, version = version + 1").Returning("*").Update(); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, model.AuditEntityUser, model.AuditRestore, id, &before, user); err != nil {
+			return err
+		}
+		// Для подписчиков восстановленный пользователь появляется снова, но это не новый пользователь
+		return recordOutbox(ctx, tx, events.UserRestored, id, user)
+	})
+	if err == nil {
+		return user, nil
+	}
+	if err != pg.ErrNoRows {
+		// Email мог занять другой пользователь, пока этот был удалён
+		return nil, mapUserError(err)
+	}
+	// Ничего не восстановлено: пользователя нет или он не удалён
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, user).WherePK())
+	if err != nil {
+		return nil, err
+	}
+	exists, err := query.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errNotDeleted
+	}
+	return nil, notFound("user")
+}
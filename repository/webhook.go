@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+
+	"laba8/model"
+)
+
+// WebhookRepository интерфейс хранилища подписок webhook и очереди их доставок. Подписки принадлежат
+// организации из контекста и получают только её события; разбор очереди общий для всех организаций
+type WebhookRepository interface {
+	Create(ctx context.Context, hook *model.Webhook) error
+	Get(ctx context.Context, id int) (*model.Webhook, error)
+	List(ctx context.Context) ([]model.Webhook, error)
+	// Update заменяет подписку; пустой Secret оставляет прежний ключ
+	Update(ctx context.Context, hook *model.Webhook) error
+	Delete(ctx context.Context, id int) error
+
+	// Enqueue ставит событие в очередь всем включённым подпискам организации на этот тип и возвращает число доставок
+	Enqueue(ctx context.Context, eventType string, payload json.RawMessage) (int, error)
+	// ClaimDue забирает до limit доставок, срок которых наступил, и откладывает их на lease,
+	// чтобы другой обработчик не отправил их одновременно
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	// RecordAttempt сохраняет результат попытки доставки
+	RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery) error
+	// Deliveries возвращает журнал доставок подписки, новые первыми; пустой status — все состояния
+	Deliveries(ctx context.Context, webhookID int, status string, limit int) ([]model.WebhookDelivery, error)
+}
+
+// pgWebhookRepository реализация WebhookRepository поверх go-pg
+type pgWebhookRepository struct {
+	db *pg.DB
+}
+
+// NewWebhookRepository функция для создания хранилища webhook в PostgreSQL
+func NewWebhookRepository(db *pg.DB) WebhookRepository {
+	return &pgWebhookRepository{db: db}
+}
+
+// Create функция для сохранения новой подписки
+func (r *pgWebhookRepository) Create(ctx context.Context, hook *model.Webhook) error {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	hook.TenantID = tenantID
+	_, err = r.db.ModelContext(ctx, hook).Returning("*").Insert()
+	return err
+}
+
+// Get функция для получения подписки по ID
+func (r *pgWebhookRepository) Get(ctx context.Context, id int) (*model.Webhook, error) {
+	hook := &model.Webhook{ID: id}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, hook).WherePK())
+	if err != nil {
+		return nil, err
+	}
+	err = query.Select()
+	if err == pg.ErrNoRows {
+		return nil, notFound("webhook")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// List функция для получения всех подписок
+func (r *pgWebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	var hooks []model.Webhook
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, &hooks))
+	if err != nil {
+		return nil, err
+	}
+	err = query.Order("id").Select()
+	return hooks, err
+}
+
+// Update функция для замены подписки
+func (r *pgWebhookRepository) Update(ctx context.Context, hook *model.Webhook) error {
+	hook.UpdatedAt = time.Now()
+	columns := []string{"url", "events", "disabled", "updated_at"}
+	if hook.Secret != "" {
+		columns = append(columns, "secret")
+	}
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, hook).Column(columns...).WherePK())
+	if err != nil {
+		return err
+	}
+	_, err = query.Returning("*").Update()
+	if err == pg.ErrNoRows {
+		return notFound("webhook")
+	}
+	return err
+}
+
+// Delete функция для удаления подписки вместе с журналом её доставок
+func (r *pgWebhookRepository) Delete(ctx context.Context, id int) error {
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, &model.Webhook{ID: id}).WherePK())
+	if err != nil {
+		return err
+	}
+	res, err := query.Delete()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return notFound("webhook")
+	}
+	return nil
+}
+
+// Enqueue функция для постановки события в очередь доставки одним запросом на все подходящие подписки
+func (r *pgWebhookRepository) Enqueue(ctx context.Context, eventType string, payload json.RawMessage) (int, error) {
+	tenantID, err := tenantFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at)
+		SELECT id, ?, ?::jsonb, ?, now()
+		FROM webhooks
+		WHERE tenant_id = ? AND NOT disabled AND (cardinality(events) = 0 OR ? = ANY(events))`,
+		eventType, string(payload), model.DeliveryPending, tenantID, eventType)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// ClaimDue функция для выборки доставок к отправке; SKIP LOCKED позволяет нескольким экземплярам
+// сервиса разбирать очередь, не мешая друг другу
+func (r *pgWebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		err := tx.Model(&deliveries).
+			Where("status = ?", model.DeliveryPending).
+			Where("next_attempt_at <= now()").
+			Order("next_attempt_at").
+			Limit(limit).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]int, 0, len(deliveries))
+		hookIDs := make([]int, 0, len(deliveries))
+		for _, d := range deliveries {
+			ids = append(ids, d.ID)
+			hookIDs = append(hookIDs, d.WebhookID)
+		}
+		_, err = tx.Model((*model.WebhookDelivery)(nil)).
+			Set("next_attempt_at = now() + ?::interval", fmt.Sprintf("%d milliseconds", lease.Milliseconds())).
+			WhereIn("id IN (?)", ids).
+			Update()
+		if err != nil {
+			return err
+		}
+
+		var hooks []model.Webhook
+		if err := tx.Model(&hooks).WhereIn("id IN (?)", hookIDs).Select(); err != nil {
+			return err
+		}
+		byID := make(map[int]*model.Webhook, len(hooks))
+		for i := range hooks {
+			byID[hooks[i].ID] = &hooks[i]
+		}
+		for i := range deliveries {
+			deliveries[i].Webhook = byID[deliveries[i].WebhookID]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt функция для сохранения результата попытки доставки
+func (r *pgWebhookRepository) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := r.db.ModelContext(ctx, delivery).
+		Column("status", "attempts", "response_code", "last_error", "next_attempt_at", "delivered_at").
+		WherePK().
+		Update()
+	return err
+}
+
+// Deliveries функция для получения журнала доставок подписки
+func (r *pgWebhookRepository) Deliveries(ctx context.Context, webhookID int, status string, limit int) ([]model.WebhookDelivery, error) {
+	query, err := scopeTenant(ctx, r.db.ModelContext(ctx, (*model.Webhook)(nil)).Where("id = ?", webhookID))
+	if err != nil {
+		return nil, err
+	}
+	exists, err := query.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFound("webhook")
+	}
+
+	var deliveries []model.WebhookDelivery
+	q := r.db.ModelContext(ctx, &deliveries).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").
+		Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Select(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
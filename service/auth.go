@@ -0,0 +1,510 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrInvalidCredentials возвращается при неверном имени или пароле
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrInvalidToken возвращается для недействительного, просроченного или отозванного access-токена
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrInvalidRefreshToken возвращается для неизвестного, просроченного или уже использованного refresh-токена
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrInviteRequired возвращается при регистрации без приглашения: присоединиться к организации можно
+// только по приглашению её администратора
+var ErrInviteRequired = errors.New("registration requires an invite")
+
+// AuthRequest структура для хранения данных авторизации
+type AuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LogValue скрывает пароль, если запрос попадёт в лог
+func (r AuthRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("username", r.Username), slog.String("password", logging.Redacted))
+}
+
+// RegisterRequest структура для хранения данных регистрации
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	// Email необязателен, без него пароль нельзя будет восстановить
+	Email string `json:"email" validate:"omitempty,email,max=254"`
+	// InviteToken токен приглашения, обязателен для /register; учётные записи консоли создаются без него
+	InviteToken string `json:"invite_token"`
+}
+
+// LogValue скрывает пароль и токен приглашения, если запрос попадёт в лог
+func (r RegisterRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("username", r.Username),
+		slog.String("password", logging.Redacted),
+		slog.String("email", r.Email),
+		slog.String("invite_token", logging.Redacted),
+	)
+}
+
+// InviteRequest структура для хранения данных приглашения в организацию
+type InviteRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin editor viewer"`
+	// Email если задан, зарегистрироваться по приглашению можно только с этим адресом
+	Email string `json:"email" validate:"omitempty,email,max=254"`
+}
+
+// RefreshRequest структура для хранения refresh-токена в запросах обновления и выхода
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogValue скрывает токен, если запрос попадёт в лог
+func (r RefreshRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("refresh_token", logging.Redacted))
+}
+
+// TokenPair структура для хранения выданной пары токенов
+type TokenPair struct {
+	// AccessToken передаётся в заголовке Authorization; поле называется token для совместимости с прежним ответом
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn срок действия access-токена в секундах
+	ExpiresIn int `json:"expires_in"`
+}
+
+// LogValue скрывает токены, если пара попадёт в лог
+func (p TokenPair) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("token", logging.Redacted),
+		slog.String("refresh_token", logging.Redacted),
+		slog.Int("expires_in", p.ExpiresIn),
+	)
+}
+
+// RoleRequest структура для хранения данных назначения роли
+type RoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin editor viewer pending"`
+}
+
+// LoginMeta структура для хранения сведений о клиенте для аудита входа
+type LoginMeta struct {
+	IP        string
+	UserAgent string
+}
+
+// Claims структура для хранения данных JWT-токена
+type Claims struct {
+	AccountID int    `json:"account_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	// TenantID организация учётной записи: запросы с токеном работают только с её данными
+	TenantID int `json:"tenant_id,omitempty"`
+	// SessionID сессия, к которой относится токен; выход отзывает все refresh-токены сессии
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Tenant функция для получения организации токена; токены, выданные до появления организаций,
+// относятся к организации по умолчанию, куда перенесены все прежние учётные записи
+func (c *Claims) Tenant() int {
+	if c.TenantID == 0 {
+		return model.DefaultTenantID
+	}
+	return c.TenantID
+}
+
+// AuthService структура сервиса учётных записей и токенов
+type AuthService struct {
+	accounts repository.AccountRepository
+	audits   repository.LoginAuditRepository
+	tokens   repository.TokenRepository
+	invites  repository.InviteRepository
+	validate *validator.Validate
+	secret   []byte
+	ttl      time.Duration
+	// refreshTTL срок действия refresh-токена
+	refreshTTL time.Duration
+	// inviteTTL срок действия приглашения
+	inviteTTL time.Duration
+}
+
+// NewAuthService функция для создания сервиса аутентификации; secret должен быть задан,
+// запасного ключа нет, иначе токены с любой ролью мог бы подписать кто угодно
+func NewAuthService(accounts repository.AccountRepository, audits repository.LoginAuditRepository, tokens repository.TokenRepository,
+	invites repository.InviteRepository, validate *validator.Validate, secret string, ttl, refreshTTL, inviteTTL time.Duration) *AuthService {
+	return &AuthService{
+		accounts:   accounts,
+		audits:     audits,
+		tokens:     tokens,
+		invites:    invites,
+		validate:   validate,
+		secret:     []byte(secret),
+		ttl:        ttl,
+		refreshTTL: refreshTTL,
+		inviteTTL:  inviteTTL,
+	}
+}
+
+// SetPasswordRequest структура для хранения нового пароля, который задаёт администратор без токена сброса
+type SetPasswordRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// LogValue скрывает пароль, если запрос попадёт в лог
+func (r SetPasswordRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("username", r.Username), slog.String("password", logging.Redacted))
+}
+
+// Register функция для регистрации учётной записи по приглашению, возвращает её и выданную пару токенов.
+// Организацию и роль задаёт приглашение, а не заголовок X-Tenant: без приглашения администратора
+// присоединиться к организации нельзя
+func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*model.Account, *TokenPair, error) {
+	if req.InviteToken == "" {
+		return nil, nil, ErrInviteRequired
+	}
+	account, err := newAccount(s.validate, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.invites.Redeem(ctx, hashToken(req.InviteToken), account); err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.issueTokens(ctx, account, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, pair, nil
+}
+
+// CreateInvite функция для выдачи приглашения в организацию из контекста; токен возвращается только здесь,
+// в базе хранится его хэш
+func (s *AuthService) CreateInvite(ctx context.Context, req InviteRequest) (*model.Invite, string, error) {
+	if err := s.validate.Struct(req); err != nil {
+		return nil, "", err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	invite := &model.Invite{
+		TokenHash: hashToken(token),
+		Role:      req.Role,
+		Email:     req.Email,
+		ExpiresAt: time.Now().Add(s.inviteTTL),
+	}
+	if err := s.invites.Create(ctx, invite); err != nil {
+		return nil, "", err
+	}
+	return invite, token, nil
+}
+
+// CreateAccount функция для создания учётной записи с ролью role в организации из контекста без выдачи токенов.
+// Первый администратор организации создаётся только вместе с ней, см. TenantService.Create
+func (s *AuthService) CreateAccount(ctx context.Context, req RegisterRequest, role string) (*model.Account, error) {
+	if err := s.validate.Struct(RoleRequest{Role: role}); err != nil {
+		return nil, err
+	}
+	account, err := newAccount(s.validate, req)
+	if err != nil {
+		return nil, err
+	}
+	account.Role = role
+	if err := s.accounts.Create(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// newAccount функция для проверки данных учётной записи и построения её с хэшем пароля; роль и организацию
+// задаёт вызывающий
+func newAccount(validate *validator.Validate, req RegisterRequest) (*model.Account, error) {
+	if err := validate.Struct(req); err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Account{Username: req.Username, Email: req.Email, PasswordHash: string(hash)}, nil
+}
+
+// SetPassword функция для смены пароля учётной записи без токена сброса, например из консоли администратора;
+// как и после сброса по токену, открытые сессии больше не продлеваются
+func (s *AuthService) SetPassword(ctx context.Context, req SetPasswordRequest) error {
+	if err := s.validate.Struct(req); err != nil {
+		return err
+	}
+	account, err := s.accounts.GetByUsername(ctx, req.Username)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.accounts.SetPassword(ctx, account.ID, string(hash))
+}
+
+// Login функция для проверки имени и пароля и выдачи пары токенов новой сессии; каждая попытка пишется в аудит
+func (s *AuthService) Login(ctx context.Context, req AuthRequest, meta LoginMeta) (*TokenPair, error) {
+	account, ok, err := s.authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	s.recordLogin(ctx, req.Username, meta, account, ok)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return s.issueTokens(ctx, account, "")
+}
+
+// maxLoginAuditsLimit наибольшее число записей журнала входов в одном ответе
+const maxLoginAuditsLimit = 200
+
+// LoginAuditParams структура для хранения фильтров журнала попыток входа; пустые поля не фильтруют
+type LoginAuditParams struct {
+	Username  string
+	AccountID *int
+	IP        string
+	Success   *bool
+	// Since и Until границы времени попытки: Since включительно, Until не включительно
+	Since *time.Time
+	Until *time.Time
+	Limit int
+}
+
+// LoginAudits функция для получения попыток входа в учётные записи организации из контекста, новые первыми.
+// Попытки с неизвестным именем не относятся ни к одной организации и сюда не попадают
+func (s *AuthService) LoginAudits(ctx context.Context, p LoginAuditParams) ([]model.LoginAudit, error) {
+	return s.audits.List(ctx, repository.LoginAuditFilter{
+		Username:  p.Username,
+		AccountID: p.AccountID,
+		IP:        p.IP,
+		Success:   p.Success,
+		Since:     p.Since,
+		Until:     p.Until,
+		Limit:     min(max(p.Limit, 1), maxLoginAuditsLimit),
+	})
+}
+
+// Refresh функция для обмена refresh-токена на новую пару. Токен одноразовый: повторное предъявление
+// уже использованного токена означает его утечку, и вся сессия отзывается
+func (s *AuthService) Refresh(ctx context.Context, req RefreshRequest) (*TokenPair, error) {
+	if req.RefreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	stored, err := s.tokens.GetRefreshByHash(ctx, hashToken(req.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	rotated := false
+	if stored.RevokedAt == nil {
+		if rotated, err = s.tokens.RevokeRefresh(ctx, stored.ID); err != nil {
+			return nil, err
+		}
+	}
+	if !rotated {
+		slog.WarnContext(ctx, "Reuse of revoked refresh token, revoking session", "account_id", stored.AccountID)
+		if err := s.tokens.RevokeSession(ctx, stored.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	// Учётная запись перечитывается, чтобы новый токен получил её текущую роль
+	account, err := s.accounts.Get(ctx, stored.AccountID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, account, stored.SessionID)
+}
+
+// Logout функция для завершения сессии: текущий access-токен попадает в список отозванных,
+// refresh-токены сессии отзываются
+func (s *AuthService) Logout(ctx context.Context, claims *Claims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := s.tokens.RevokeAccess(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+	if claims.SessionID != "" {
+		return s.tokens.RevokeSession(ctx, claims.SessionID)
+	}
+	return nil
+}
+
+// AssignRole функция для назначения роли учётной записи своей организации
+func (s *AuthService) AssignRole(ctx context.Context, id int, req RoleRequest) (*model.Account, error) {
+	if err := s.validate.Struct(req); err != nil {
+		return nil, err
+	}
+	// Новая роль вступит в силу после повторного входа, когда будет выдан новый токен
+	return s.accounts.UpdateRole(ctx, id, req.Role)
+}
+
+// ParseToken функция для проверки подписи и срока действия токена
+func (s *AuthService) ParseToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// VerifyToken функция для проверки access-токена: подпись, срок действия и отсутствие в списке отозванных
+func (s *AuthService) VerifyToken(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims, err := s.ParseToken(tokenStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.ID != "" {
+		revoked, err := s.tokens.IsAccessRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: token has been revoked", ErrInvalidToken)
+		}
+	}
+	return claims, nil
+}
+
+// issueTokens функция для выдачи access- и refresh-токена; пустой sessionID начинает новую сессию
+func (s *AuthService) issueTokens(ctx context.Context, account *model.Account, sessionID string) (*TokenPair, error) {
+	var err error
+	if sessionID == "" {
+		if sessionID, err = randomToken(16); err != nil {
+			return nil, err
+		}
+	}
+	access, err := s.issueToken(account, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokens.CreateRefresh(ctx, &model.RefreshToken{
+		AccountID: account.ID,
+		TokenHash: hashToken(refresh),
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.ttl.Seconds()),
+	}, nil
+}
+
+// issueToken функция для выдачи подписанного JWT для учётной записи; jti позволяет отозвать токен до истечения срока
+func (s *AuthService) issueToken(account *model.Account, sessionID string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := Claims{
+		AccountID: account.ID,
+		Username:  account.Username,
+		Role:      account.Role,
+		TenantID:  account.TenantID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// randomToken функция для генерации случайной строки из n байт в base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken функция для получения хэша refresh-токена, под которым он хранится в базе
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate функция для проверки имени и пароля; возвращает учётную запись с этим именем, если она есть,
+// и ok, если пароль подошёл
+func (s *AuthService) authenticate(ctx context.Context, username, password string) (*model.Account, bool, error) {
+	account, err := s.accounts.GetByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Сравнение с фиктивным хэшем выравнивает время ответа для несуществующих имён
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	ok := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) == nil
+	return account, ok, nil
+}
+
+// recordLogin функция для записи попытки входа в журнал аудита; попытка с известным именем относится
+// к этой учётной записи и её организации, даже если пароль не подошёл
+func (s *AuthService) recordLogin(ctx context.Context, username string, meta LoginMeta, account *model.Account, success bool) {
+	audit := &model.LoginAudit{
+		Username:  username,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		Success:   success,
+	}
+	if account != nil {
+		audit.AccountID = &account.ID
+		audit.TenantID = &account.TenantID
+	}
+	// Попытка фиксируется, даже если клиент уже отключился.
+	// Ошибка записи аудита не должна мешать входу, поэтому только логируется
+	if err := s.audits.Record(context.WithoutCancel(ctx), audit); err != nil {
+		slog.ErrorContext(ctx, "Failed to record login audit", "err", err)
+	}
+}
+
+// dummyHash хэш, с которым сравнивается пароль несуществующей учётной записи
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
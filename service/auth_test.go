@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+// fakeInvites приглашения в памяти: Redeem принимает только известный хэш и задаёт организацию и роль
+type fakeInvites struct {
+	repository.InviteRepository
+	hash     string
+	tenantID int
+	role     string
+	created  []*model.Invite
+}
+
+func (f *fakeInvites) Create(ctx context.Context, invite *model.Invite) error {
+	invite.ID = len(f.created) + 1
+	f.created = append(f.created, invite)
+	return nil
+}
+
+func (f *fakeInvites) Redeem(ctx context.Context, tokenHash string, account *model.Account) error {
+	if tokenHash != f.hash {
+		return repository.ErrInviteInvalid
+	}
+	account.ID = 7
+	account.TenantID = f.tenantID
+	account.Role = f.role
+	return nil
+}
+
+// fakeTokens хранилище токенов, которому достаточно принять refresh-токен
+type fakeTokens struct {
+	repository.TokenRepository
+}
+
+func (fakeTokens) CreateRefresh(ctx context.Context, token *model.RefreshToken) error { return nil }
+
+func newTestAuth(invites repository.InviteRepository) *AuthService {
+	return NewAuthService(nil, nil, fakeTokens{}, invites, NewValidator(),
+		"0123456789abcdef0123456789abcdef", time.Minute, time.Hour, time.Hour)
+}
+
+func TestRegisterRequiresInvite(t *testing.T) {
+	s := newTestAuth(&fakeInvites{})
+	_, _, err := s.Register(context.Background(), RegisterRequest{Username: "stranger", Password: "secret123"})
+	if !errors.Is(err, ErrInviteRequired) {
+		t.Fatalf("Register error = %v, want ErrInviteRequired", err)
+	}
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	invites := &fakeInvites{hash: hashToken("invite-token"), tenantID: 3, role: model.RoleEditor}
+	s := newTestAuth(invites)
+
+	_, _, err := s.Register(context.Background(), RegisterRequest{Username: "bob", Password: "secret123", InviteToken: "wrong"})
+	if !errors.Is(err, repository.ErrInviteInvalid) {
+		t.Fatalf("Register with unknown invite error = %v, want ErrInviteInvalid", err)
+	}
+
+	account, pair, err := s.Register(context.Background(), RegisterRequest{Username: "bob", Password: "secret123", InviteToken: "invite-token"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if account.TenantID != 3 || account.Role != model.RoleEditor {
+		t.Fatalf("account tenant %d role %q, want tenant 3 role editor", account.TenantID, account.Role)
+	}
+	claims, err := s.ParseToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Tenant() != 3 || claims.Role != model.RoleEditor {
+		t.Fatalf("token tenant %d role %q, want tenant 3 role editor", claims.Tenant(), claims.Role)
+	}
+}
+
+func TestCreateInvite(t *testing.T) {
+	invites := &fakeInvites{}
+	s := newTestAuth(invites)
+
+	if _, _, err := s.CreateInvite(context.Background(), InviteRequest{Role: model.RolePending}); err == nil {
+		t.Fatal("CreateInvite with role pending succeeded, want validation error")
+	}
+	invite, token, err := s.CreateInvite(context.Background(), InviteRequest{Role: model.RoleViewer, Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if token == "" || invite.TokenHash != hashToken(token) {
+		t.Fatalf("stored hash %q does not match token %q", invite.TokenHash, token)
+	}
+	if time.Until(invite.ExpiresAt) <= 0 {
+		t.Fatalf("invite expires at %v, want in the future", invite.ExpiresAt)
+	}
+}
+
+// fakeAccounts учётные записи в памяти по имени
+type fakeAccounts struct {
+	repository.AccountRepository
+	byName map[string]*model.Account
+}
+
+func (f *fakeAccounts) GetByUsername(ctx context.Context, username string) (*model.Account, error) {
+	account, ok := f.byName[username]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return account, nil
+}
+
+// fakeLoginAudits журнал попыток входа в памяти
+type fakeLoginAudits struct {
+	records []*model.LoginAudit
+	filter  repository.LoginAuditFilter
+}
+
+func (f *fakeLoginAudits) Record(ctx context.Context, audit *model.LoginAudit) error {
+	f.records = append(f.records, audit)
+	return nil
+}
+
+func (f *fakeLoginAudits) List(ctx context.Context, filter repository.LoginAuditFilter) ([]model.LoginAudit, error) {
+	f.filter = filter
+	return nil, nil
+}
+
+func newLoginTestAuth(t *testing.T) (*AuthService, *fakeLoginAudits) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := &fakeAccounts{byName: map[string]*model.Account{
+		"alice": {ID: 5, TenantID: 2, Username: "alice", PasswordHash: string(hash), Role: model.RoleViewer},
+	}}
+	audits := &fakeLoginAudits{}
+	s := NewAuthService(accounts, audits, fakeTokens{}, nil, NewValidator(),
+		"0123456789abcdef0123456789abcdef", time.Minute, time.Hour, time.Hour)
+	return s, audits
+}
+
+func TestLoginRecordsAudit(t *testing.T) {
+	meta := LoginMeta{IP: "203.0.113.7", UserAgent: "curl/8.0"}
+	tests := []struct {
+		name        string
+		req         AuthRequest
+		wantErr     error
+		wantSuccess bool
+		wantAccount bool
+	}{
+		{"success", AuthRequest{Username: "alice", Password: "secret123"}, nil, true, true},
+		{"wrong password", AuthRequest{Username: "alice", Password: "guess-1234"}, ErrInvalidCredentials, false, true},
+		{"unknown username", AuthRequest{Username: "mallory", Password: "guess-1234"}, ErrInvalidCredentials, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, audits := newLoginTestAuth(t)
+			if _, err := s.Login(context.Background(), tt.req, meta); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login error = %v, want %v", err, tt.wantErr)
+			}
+			if len(audits.records) != 1 {
+				t.Fatalf("recorded %d login audits, want 1", len(audits.records))
+			}
+			got := audits.records[0]
+			if got.Username != tt.req.Username || got.IP != meta.IP || got.UserAgent != meta.UserAgent || got.Success != tt.wantSuccess {
+				t.Fatalf("audit = %+v, want username %q, ip %q, user agent %q, success %v",
+					got, tt.req.Username, meta.IP, meta.UserAgent, tt.wantSuccess)
+			}
+			if tt.wantAccount && (got.AccountID == nil || *got.AccountID != 5 || got.TenantID == nil || *got.TenantID != 2) {
+				t.Fatalf("audit account %v tenant %v, want account 5 tenant 2", got.AccountID, got.TenantID)
+			}
+			if !tt.wantAccount && (got.AccountID != nil || got.TenantID != nil) {
+				t.Fatalf("audit of unknown username has account %v tenant %v, want none", got.AccountID, got.TenantID)
+			}
+			// Пароль не должен попасть ни в одно поле записи
+			if encoded, _ := json.Marshal(got); strings.Contains(string(encoded), tt.req.Password) {
+				t.Fatalf("audit %s contains the attempted password", encoded)
+			}
+		})
+	}
+}
+
+func TestLoginAuditsClampsLimit(t *testing.T) {
+	s, audits := newLoginTestAuth(t)
+	for limit, want := range map[int]int{0: 1, 10: 10, 5000: maxLoginAuditsLimit} {
+		if _, err := s.LoginAudits(context.Background(), LoginAuditParams{Limit: limit}); err != nil {
+			t.Fatalf("LoginAudits: %v", err)
+		}
+		if audits.filter.Limit != want {
+			t.Errorf("LoginAudits(limit=%d) filter limit = %d, want %d", limit, audits.filter.Limit, want)
+		}
+	}
+}
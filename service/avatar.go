@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // декодер GIF для image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"laba8/model"
+	"laba8/repository"
+	"laba8/storage"
+)
+
+// ErrUnsupportedImage возвращается для файла, который не является изображением JPEG, PNG или GIF
+var ErrUnsupportedImage = errors.New("avatar must be a JPEG, PNG or GIF image")
+
+// ErrImageTooLarge возвращается для изображения, размеры которого больше допустимых
+var ErrImageTooLarge = errors.New("avatar image dimensions are too large")
+
+// maxAvatarPixels предел числа пикселей: файл небольшого размера может распаковаться в огромное изображение
+const maxAvatarPixels = 25_000_000
+
+// AvatarService структура сервиса аватаров: исходный файл и миниатюра хранятся в Storage, ссылка — в профиле
+type AvatarService struct {
+	users     repository.UserRepository
+	profiles  repository.ProfileRepository
+	files     storage.Storage
+	thumbSize int
+}
+
+// NewAvatarService функция для создания сервиса аватаров; thumbSize — наибольшая сторона миниатюры в пикселях
+func NewAvatarService(users repository.UserRepository, profiles repository.ProfileRepository, files storage.Storage, thumbSize int) *AvatarService {
+	return &AvatarService{users: users, profiles: profiles, files: files, thumbSize: thumbSize}
+}
+
+// avatarKey функция для построения ключа файла аватара в хранилище
+func avatarKey(userID int, thumb bool) string {
+	name := "original"
+	if thumb {
+		name = "thumb"
+	}
+	return "avatars/" + strconv.Itoa(userID) + "/" + name
+}
+
+// Upload функция для проверки изображения, сохранения его и миниатюры и записи ссылки в профиль
+func (s *AvatarService) Upload(ctx context.Context, userID int, data []byte) (*model.Profile, error) {
+	if _, err := s.users.Get(ctx, userID, repository.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	// Тип определяется по содержимому, а не по заголовку, присланному клиентом
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var thumb bytes.Buffer
+	thumbType := "image/png"
+	if contentType == "image/jpeg" {
+		thumbType = "image/jpeg"
+		err = jpeg.Encode(&thumb, thumbnail(img, s.thumbSize), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&thumb, thumbnail(img, s.thumbSize))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.files.Put(ctx, avatarKey(userID, false), bytes.NewReader(data), contentType); err != nil {
+		return nil, err
+	}
+	if err := s.files.Put(ctx, avatarKey(userID, true), &thumb, thumbType); err != nil {
+		return nil, err
+	}
+	return s.profiles.SetAvatar(ctx, userID, "/users/"+strconv.Itoa(userID)+"/avatar")
+}
+
+// Get функция для открытия аватара или его миниатюры; объект нужно закрыть
+func (s *AvatarService) Get(ctx context.Context, userID int, thumb bool) (*storage.Object, error) {
+	// Аватар мягко удалённого пользователя не отдаётся
+	if _, err := s.users.Get(ctx, userID, repository.GetOptions{}); err != nil {
+		return nil, err
+	}
+	obj, err := s.files.Get(ctx, avatarKey(userID, thumb))
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, fmt.Errorf("avatar %w", repository.ErrNotFound)
+	}
+	return obj, err
+}
+
+// thumbnail функция для уменьшения изображения так, чтобы большая сторона не превышала size;
+// каждый пиксель результата — среднее по соответствующей области исходника
+func thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
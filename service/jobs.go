@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrJobPermanent оборачивает ошибку задачи, которую бессмысленно повторять, например испорченные входные данные
+var ErrJobPermanent = errors.New("permanent job error")
+
+// Типы фоновых задач
+const (
+	JobVerificationEmail  = "email.verification"
+	JobPasswordResetEmail = "email.password_reset"
+	JobImportUsers        = "users.import"
+)
+
+// Параметры разбора очереди задач
+const (
+	jobPollInterval = time.Second
+	// jobMaxBackoff верхняя граница паузы между повторами
+	jobMaxBackoff = time.Hour
+	// jobRetention сколько завершённые задачи хранятся, чтобы клиент успел узнать итог
+	jobRetention   = 7 * 24 * time.Hour
+	jobPurgePeriod = time.Hour
+)
+
+// JobHandler функция выполнения задачи одного типа; возвращает итог, который сохраняется в Result
+type JobHandler func(ctx context.Context, payload json.RawMessage) (result interface{}, err error)
+
+// JobOptions структура для хранения настроек выполнения фоновых задач
+type JobOptions struct {
+	// Workers сколько задач выполняется одновременно в одном экземпляре сервиса
+	Workers int
+	// MaxAttempts сколько попыток делается, прежде чем задача помечается неудачной
+	MaxAttempts int
+	// BaseBackoff пауза перед первым повтором; каждая следующая вдвое длиннее
+	BaseBackoff time.Duration
+	// Timeout предельное время одной попытки
+	Timeout time.Duration
+}
+
+// JobRunner структура фонового выполнения задач: очередь в базе, пул обработчиков и повторы с паузой
+type JobRunner struct {
+	repo     repository.JobRepository
+	opts     JobOptions
+	handlers map[string]JobHandler
+	// wake будит цикл разбора, когда задачу поставили в этом же экземпляре, не дожидаясь опроса
+	wake chan struct{}
+}
+
+// NewJobRunner функция для создания исполнителя задач; обработчики регистрируются через Register до Run
+func NewJobRunner(repo repository.JobRepository, opts JobOptions) *JobRunner {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	return &JobRunner{
+		repo:     repo,
+		opts:     opts,
+		handlers: map[string]JobHandler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register функция для регистрации обработчика задач типа jobType
+func (j *JobRunner) Register(jobType string, handler JobHandler) {
+	j.handlers[jobType] = handler
+}
+
+// Enqueue функция для постановки задачи в очередь; payload кодируется в JSON
+func (j *JobRunner) Enqueue(ctx context.Context, jobType string, payload interface{}) (*model.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &model.Job{Type: jobType, Payload: data, MaxAttempts: j.opts.MaxAttempts}
+	if err := j.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get функция для получения задачи по ID
+func (j *JobRunner) Get(ctx context.Context, id int) (*model.Job, error) {
+	return j.repo.Get(ctx, id)
+}
+
+// Run функция для выполнения задач до отмены ctx. Попытки, прерванные остановкой, возвращаются в очередь
+func (j *JobRunner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	// Свободные места пула: задач берётся не больше, чем есть свободных обработчиков
+	slots := make(chan struct{}, j.opts.Workers)
+	for i := 0; i < j.opts.Workers; i++ {
+		slots <- struct{}{}
+	}
+	poll := time.NewTicker(jobPollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(jobPurgePeriod)
+	defer purge.Stop()
+
+	for {
+		if free := len(slots); free > 0 {
+			// Аренда с запасом на медленную попытку, чтобы задачу не взяли второй раз, пока она идёт
+			jobs, err := j.repo.ClaimDue(ctx, free, 2*j.opts.Timeout+time.Minute)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Failed to read job queue", "err", err)
+			}
+			for i := range jobs {
+				<-slots
+				wg.Add(1)
+				go func(job *model.Job) {
+					defer wg.Done()
+					defer func() { slots <- struct{}{} }()
+					j.execute(ctx, job)
+				}(&jobs[i])
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.wake:
+		case <-poll.C:
+		case <-purge.C:
+			j.purge(ctx)
+		}
+	}
+}
+
+// execute функция для выполнения одной попытки задачи и записи её итога
+func (j *JobRunner) execute(ctx context.Context, job *model.Job) {
+	handler, ok := j.handlers[job.Type]
+	var result interface{}
+	var err error
+	switch {
+	case !ok:
+		err = fmt.Errorf("%w: unknown job type %q", ErrJobPermanent, job.Type)
+	case job.Attempts > job.MaxAttempts:
+		// Попытки кончились на задачах, которые обрывались вместе с обработчиком
+		err = fmt.Errorf("%w: worker stopped during the job too many times", ErrJobPermanent)
+	default:
+		result, err = j.call(ctx, handler, job)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// Попытку прервала остановка сервиса: она не засчитывается, задача сразу возвращается в очередь
+		job.Status = model.JobQueued
+		job.Attempts--
+		job.RunAt = time.Now()
+	} else {
+		j.finish(job, result, err)
+	}
+	// Итог сохраняется и во время остановки сервиса, иначе выполненная задача запустилась бы повторно
+	if err := j.repo.Record(context.WithoutCancel(ctx), job); err != nil {
+		slog.Error("Failed to record job", "job_id", job.ID, "err", err)
+	}
+}
+
+// call функция для вызова обработчика с ограничением времени; паника считается ошибкой попытки
+func (j *JobRunner) call(ctx context.Context, handler JobHandler, job *model.Job) (result interface{}, err error) {
+	// Задача видит пользователей только той организации, в которой её поставили
+	ctx = repository.WithTenant(ctx, job.TenantID)
+	// Логи задачи связаны с запросом, который её поставил
+	ctx = logging.With(logging.WithRequestID(ctx, job.RequestID), slog.Int("job_id", job.ID), slog.String("job_type", job.Type))
+	if job.AccountID != nil {
+		// Автор изменений для журнала — тот, кто поставил задачу
+		ctx = repository.WithActor(ctx, repository.Actor{AccountID: *job.AccountID, Username: job.Actor, RequestID: job.RequestID})
+	}
+	if j.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(ctx, "Panic in job", "panic", p, "stack", string(debug.Stack()))
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+// finish функция для перевода задачи в итоговое состояние или назначения повтора
+func (j *JobRunner) finish(job *model.Job, result interface{}, err error) {
+	now := time.Now()
+	switch {
+	case err == nil:
+		job.Status = model.JobSucceeded
+		job.LastError = ""
+		job.FinishedAt = &now
+		if result != nil {
+			data, mErr := json.Marshal(result)
+			if mErr != nil {
+				slog.Error("Failed to encode job result", "job_id", job.ID, "err", mErr)
+			}
+			job.Result = data
+		}
+	case errors.Is(err, ErrJobPermanent) || job.Attempts >= job.MaxAttempts:
+		job.Status = model.JobFailed
+		job.LastError = err.Error()
+		job.FinishedAt = &now
+		slog.Warn("Job failed", "job_id", job.ID, "job_type", job.Type, "attempts", job.Attempts, "request_id", job.RequestID, "err", err)
+	default:
+		job.Status = model.JobQueued
+		job.LastError = err.Error()
+		job.RunAt = now.Add(retryBackoff(j.opts.BaseBackoff, jobMaxBackoff, job.Attempts))
+	}
+}
+
+// purge функция для удаления старых завершённых задач
+func (j *JobRunner) purge(ctx context.Context) {
+	n, err := j.repo.Purge(ctx, time.Now().Add(-jobRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to purge jobs", "err", err)
+		}
+		return
+	}
+	if n > 0 {
+		slog.Info("Purged finished jobs", "count", n)
+	}
+}
+
+// decodeJobPayload функция для разбора входных данных задачи; ошибка разбора повторять бессмысленно
+func decodeJobPayload(payload json.RawMessage, dst interface{}) error {
+	if err := json.Unmarshal(payload, dst); err != nil {
+		return fmt.Errorf("%w: decode payload: %v", ErrJobPermanent, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"laba8/events"
+	"laba8/logging"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// Параметры разбора outbox
+const (
+	// outboxPollInterval опрос на случай пропущенного NOTIFY, например пока слушатель переподключается
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 100
+	// outboxLease на сколько взятое событие скрывается от других экземпляров, пока публикуется
+	outboxLease = 30 * time.Second
+	// outboxRetention сколько опубликованные события хранятся для разбора инцидентов
+	outboxRetention   = 7 * 24 * time.Hour
+	outboxPurgePeriod = time.Hour
+)
+
+// OutboxSink функция-получатель события из outbox. Ошибка оставляет событие в outbox до следующей попытки
+type OutboxSink func(ctx context.Context, e events.Event) error
+
+// PublishTo функция для получателя, который рассылает события подписчикам шины (поток /events)
+func PublishTo(hub *events.Hub) OutboxSink {
+	return func(_ context.Context, e events.Event) error {
+		hub.Publish(e)
+		return nil
+	}
+}
+
+// OutboxDispatcher структура фоновой публикации событий из outbox. Событие отмечается опубликованным,
+// только когда его приняли все получатели, поэтому доставка «хотя бы один раз»: после падения между
+// публикацией и отметкой событие уйдёт повторно
+type OutboxDispatcher struct {
+	repo  repository.OutboxRepository
+	sinks []OutboxSink
+}
+
+// NewOutboxDispatcher функция для создания диспетчера outbox. Получатели вызываются по порядку;
+// тот, что не может вернуть ошибку, лучше ставить последним, чтобы повтор не дублировал ему события
+func NewOutboxDispatcher(repo repository.OutboxRepository, sinks ...OutboxSink) *OutboxDispatcher {
+	return &OutboxDispatcher{repo: repo, sinks: sinks}
+}
+
+// Run функция для разбора outbox до отмены ctx: по уведомлению о новых событиях и по таймеру
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	wake, stop := d.repo.Listen(ctx)
+	defer stop()
+	poll := time.NewTicker(outboxPollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(outboxPurgePeriod)
+	defer purge.Stop()
+
+	for {
+		d.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-wake:
+			if !ok {
+				// Слушатель закрыт: остаётся опрос по таймеру
+				wake = nil
+			}
+		case <-poll.C:
+		case <-purge.C:
+			d.purge(ctx)
+		}
+	}
+}
+
+// drain функция для публикации всех накопившихся событий порциями
+func (d *OutboxDispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := d.repo.Claim(ctx, outboxBatchSize, outboxLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read outbox", "err", err)
+			}
+			return
+		}
+		published := d.dispatch(ctx, batch)
+		// Отметка сохраняется и во время остановки сервиса, иначе опубликованное ушло бы повторно
+		if err := d.repo.MarkPublished(context.WithoutCancel(ctx), published); err != nil {
+			slog.Error("Failed to mark outbox events published", "count", len(published), "err", err)
+			d.release(ctx, batch)
+			return
+		}
+		if len(published) < len(batch) {
+			d.release(ctx, batch[len(published):])
+			return
+		}
+		if len(batch) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// release функция для возврата неопубликованного остатка порции в очередь. Пока lease не истёк,
+// Claim пропускал бы эти события и отдал бы получателям записанные после них
+func (d *OutboxDispatcher) release(ctx context.Context, rest []model.OutboxEvent) {
+	ids := make([]int, 0, len(rest))
+	for _, e := range rest {
+		ids = append(ids, e.ID)
+	}
+	if err := d.repo.Release(context.WithoutCancel(ctx), ids); err != nil {
+		slog.Error("Failed to release outbox events", "count", len(ids), "err", err)
+	}
+}
+
+// dispatch функция для передачи событий получателям в порядке записи; на первой ошибке разбор
+// останавливается, а остаток порции drain возвращает в очередь, чтобы события одного пользователя
+// не обогнали друг друга. Возвращает ID опубликованных — всегда начало порции
+func (d *OutboxDispatcher) dispatch(ctx context.Context, batch []model.OutboxEvent) []int {
+	published := make([]int, 0, len(batch))
+	for i := range batch {
+		e, err := outboxEvent(&batch[i])
+		if err != nil {
+			// Испорченное событие не должно навсегда остановить outbox
+			slog.Error("Skipping malformed outbox event", "event_id", batch[i].ID, "err", err)
+			published = append(published, batch[i].ID)
+			continue
+		}
+		// Получатели и их логи видят ID запроса, который вызвал изменение
+		eventCtx := logging.WithRequestID(ctx, e.RequestID)
+		for _, sink := range d.sinks {
+			if err := sink(eventCtx, e); err != nil {
+				if ctx.Err() == nil {
+					slog.WarnContext(eventCtx, "Failed to publish outbox event, will retry", "event_id", batch[i].ID, "err", err)
+				}
+				return published
+			}
+		}
+		published = append(published, batch[i].ID)
+	}
+	return published
+}
+
+// purge функция для удаления старых опубликованных событий
+func (d *OutboxDispatcher) purge(ctx context.Context) {
+	n, err := d.repo.Purge(ctx, time.Now().Add(-outboxRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to purge outbox", "err", err)
+		}
+		return
+	}
+	if n > 0 {
+		slog.Info("Purged published outbox events", "count", n)
+	}
+}
+
+// outboxEvent функция для перевода записи outbox в событие шины
+func outboxEvent(o *model.OutboxEvent) (events.Event, error) {
+	e := events.Event{
+		ID:        uint64(o.ID),
+		Type:      o.EventType,
+		TenantID:  o.TenantID,
+		UserID:    o.UserID,
+		RequestID: o.RequestID,
+		Time:      o.CreatedAt.UTC(),
+	}
+	if len(o.Payload) > 0 && string(o.Payload) != "null" {
+		e.User = &model.User{}
+		if err := json.Unmarshal(o.Payload, e.User); err != nil {
+			return events.Event{}, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"laba8/events"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// fakeOutbox outbox в памяти с тем же lease, что и в PostgreSQL: взятое событие скрыто до available_at
+type fakeOutbox struct {
+	repository.OutboxRepository
+	mu   sync.Mutex
+	rows []model.OutboxEvent
+}
+
+// add функция для записи события, как recordOutbox в транзакции изменения пользователя
+func (f *fakeOutbox) add(userID int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	f.rows = append(f.rows, model.OutboxEvent{
+		ID: len(f.rows) + 1, EventType: events.UserUpdated, TenantID: model.DefaultTenantID, UserID: userID,
+		CreatedAt: now, AvailableAt: now,
+	})
+}
+
+func (f *fakeOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	var pending []model.OutboxEvent
+	for i := range f.rows {
+		row := &f.rows[i]
+		if row.PublishedAt == nil && !row.AvailableAt.After(now) && len(pending) < limit {
+			row.AvailableAt = now.Add(lease)
+			pending = append(pending, *row)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	return pending, nil
+}
+
+func (f *fakeOutbox) MarkPublished(ctx context.Context, ids []int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		f.rows[id-1].PublishedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeOutbox) Release(ctx context.Context, ids []int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if f.rows[id-1].PublishedAt == nil {
+			f.rows[id-1].AvailableAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func TestOutboxRetryKeepsOrder(t *testing.T) {
+	repo := &fakeOutbox{}
+	for i := 0; i < 3; i++ {
+		repo.add(1)
+	}
+
+	// Первый получатель, как очередь вебхуков, один раз отказывает на втором событии
+	failed := false
+	flaky := func(_ context.Context, e events.Event) error {
+		if e.ID == 2 && !failed {
+			failed = true
+			return errors.New("webhook queue is unavailable")
+		}
+		return nil
+	}
+	var delivered []uint64
+	record := func(_ context.Context, e events.Event) error {
+		delivered = append(delivered, e.ID)
+		return nil
+	}
+	d := NewOutboxDispatcher(repo, flaky, record)
+
+	d.drain(context.Background())
+	if fmt.Sprint(delivered) != "[1]" {
+		t.Fatalf("delivered %v before the failure, want [1]", delivered)
+	}
+
+	// Событие, записанное после сбоя, не должно обогнать неопубликованные 2 и 3
+	repo.add(1)
+	d.drain(context.Background())
+	if fmt.Sprint(delivered) != "[1 2 3 4]" {
+		t.Fatalf("delivered %v after the retry, want [1 2 3 4]", delivered)
+	}
+	for _, row := range repo.rows {
+		if row.PublishedAt == nil {
+			t.Fatalf("event %d is not marked published", row.ID)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+
+	"laba8/logging"
+	"laba8/mailer"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ForgotPasswordRequest структура для хранения запроса на сброс пароля
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest структура для хранения токена из письма и нового пароля
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// LogValue скрывает токен и пароль, если запрос попадёт в лог
+func (r ResetPasswordRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("token", logging.Redacted), slog.String("password", logging.Redacted))
+}
+
+// PasswordResetService структура сервиса восстановления пароля
+type PasswordResetService struct {
+	accounts repository.AccountRepository
+	resets   repository.ResetTokenRepository
+	mail     mailer.Mailer
+	jobs     *JobRunner
+	validate *validator.Validate
+	ttl      time.Duration
+}
+
+// NewPasswordResetService функция для создания сервиса восстановления пароля; ttl — срок действия токена.
+// Письма отправляются фоновыми задачами jobs, обработчик регистрируется здесь
+func NewPasswordResetService(accounts repository.AccountRepository, resets repository.ResetTokenRepository, mail mailer.Mailer,
+	jobs *JobRunner, validate *validator.Validate, ttl time.Duration) *PasswordResetService {
+	s := &PasswordResetService{accounts: accounts, resets: resets, mail: mail, jobs: jobs, validate: validate, ttl: ttl}
+	jobs.Register(JobPasswordResetEmail, s.runForgotJob)
+	return s
+}
+
+// forgotJob структура входных данных задачи отправки токена сброса
+type forgotJob struct {
+	Email string `json:"email"`
+}
+
+// Forgot функция для постановки задачи на выдачу токена сброса и отправку его на email учётной записи.
+// Поиск учётной записи идёт уже в задаче: ответ и время ответа не зависят от того, зарегистрирован ли email
+func (s *PasswordResetService) Forgot(ctx context.Context, req ForgotPasswordRequest) error {
+	if err := s.validate.Struct(req); err != nil {
+		return err
+	}
+	_, err := s.jobs.Enqueue(ctx, JobPasswordResetEmail, forgotJob{Email: req.Email})
+	return err
+}
+
+// runForgotJob функция для выполнения задачи сброса: токен выдаётся при каждой попытке,
+// поэтому в очереди хранится только адрес, а не сам токен
+func (s *PasswordResetService) runForgotJob(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var job forgotJob
+	if err := decodeJobPayload(payload, &job); err != nil {
+		return nil, err
+	}
+	account, err := s.accounts.GetByEmail(ctx, job.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.resets.Create(ctx, &model.ResetToken{
+		AccountID: account.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.mail.Send(ctx, mailer.Message{
+		To:      account.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password, send this token to POST /auth/reset-password:\n%s\n\n"+
+			"The token is valid for %s. If you did not request a reset, ignore this email.\n", account.Username, token, s.ttl),
+	})
+}
+
+// Reset функция для установки нового пароля по токену; после смены все refresh-токены учётной записи отзываются
+func (s *PasswordResetService) Reset(ctx context.Context, req ResetPasswordRequest) error {
+	if err := s.validate.Struct(req); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	accountID, err := s.resets.ResetPassword(ctx, hashToken(req.Token), string(hash))
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Password reset", "account_id", accountID)
+	return nil
+}
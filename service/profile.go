@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ProfileService структура сервиса профилей пользователей
+type ProfileService struct {
+	repo     repository.ProfileRepository
+	validate *validator.Validate
+}
+
+// NewProfileService функция для создания сервиса профилей
+func NewProfileService(repo repository.ProfileRepository, validate *validator.Validate) *ProfileService {
+	return &ProfileService{repo: repo, validate: validate}
+}
+
+// Get функция для получения профиля пользователя
+func (s *ProfileService) Get(ctx context.Context, userID int) (*model.Profile, error) {
+	return s.repo.Get(ctx, userID)
+}
+
+// Save функция для валидации и сохранения профиля пользователя целиком
+func (s *ProfileService) Save(ctx context.Context, profile *model.Profile) error {
+	if err := s.validate.Struct(profile); err != nil {
+		return err
+	}
+	return s.repo.Save(ctx, profile)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrInvalidSearch возвращается, если в поисковом запросе нет ни одного слова
+var ErrInvalidSearch = errors.New("search query must contain at least one letter or digit")
+
+// Ограничения поискового запроса, чтобы длинная строка не превращалась в тяжёлый tsquery
+const (
+	searchMaxLength = 200
+	searchMaxTerms  = 10
+)
+
+// SearchParams структура для хранения параметров полнотекстового поиска пользователей
+type SearchParams struct {
+	Query string
+	Page  int
+	Limit int
+	// IncludeDeleted включает мягко удалённых пользователей
+	IncludeDeleted bool
+}
+
+// SearchResult структура для хранения страницы результатов поиска
+type SearchResult struct {
+	Hits []model.UserSearchHit
+	// Total число совпавших пользователей без учёта пагинации
+	Total int
+}
+
+// Search функция для полнотекстового поиска пользователей по имени и email.
+// Каждое слово запроса ищется по префиксу, совпасть должны все слова
+func (s *UserService) Search(ctx context.Context, p SearchParams) (*SearchResult, error) {
+	tsquery := buildTSQuery(p.Query)
+	if tsquery == "" {
+		return nil, ErrInvalidSearch
+	}
+	hits, total, err := s.repo.Search(ctx, repository.SearchFilter{
+		TSQuery:        tsquery,
+		IncludeDeleted: p.IncludeDeleted,
+		Offset:         (p.Page - 1) * p.Limit,
+		Limit:          p.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult{Hits: hits, Total: total}, nil
+}
+
+// buildTSQuery функция для сборки tsquery вида "слово:* & слово:*" из запроса пользователя.
+// В запрос попадают только буквы и цифры, поэтому операторы tsquery из строки клиента не проходят
+func buildTSQuery(q string) string {
+	if len(q) > searchMaxLength {
+		q = q[:searchMaxLength]
+	}
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > searchMaxTerms {
+		words = words[:searchMaxTerms]
+	}
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
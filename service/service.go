@@ -0,0 +1,29 @@
+// Package service содержит бизнес-логику поверх интерфейсов хранилища:
+// валидацию входных данных, выдачу токенов и правила работы с пользователями.
+package service
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator функция для создания валидатора, который называет поля по json-тегам
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+	return validate
+}
+
+// jsonFieldName функция для подстановки имени поля из json-тега в ошибки валидатора
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+// TenantService структура сервиса организаций-клиентов
+type TenantService struct {
+	repo     repository.TenantRepository
+	validate *validator.Validate
+	// bySlug найденные организации: slug не меняется, поэтому запись не устаревает
+	mu     sync.RWMutex
+	bySlug map[string]int
+}
+
+// NewTenantService функция для создания сервиса организаций
+func NewTenantService(repo repository.TenantRepository, validate *validator.Validate) *TenantService {
+	return &TenantService{repo: repo, validate: validate, bySlug: map[string]int{}}
+}
+
+// Create функция для валидации и сохранения новой организации вместе с её первым администратором.
+// Других способов получить первого администратора организации нет: регистрация идёт только по приглашению
+func (s *TenantService) Create(ctx context.Context, tenant *model.Tenant, admin RegisterRequest) (*model.Account, error) {
+	if err := s.validate.Struct(tenant); err != nil {
+		return nil, err
+	}
+	account, err := newAccount(s.validate, admin)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, tenant, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// List функция для получения всех организаций
+func (s *TenantService) List(ctx context.Context) ([]model.Tenant, error) {
+	return s.repo.List(ctx)
+}
+
+// Resolve функция для получения ID организации по slug из заголовка X-Tenant; неизвестный slug — ErrNotFound
+func (s *TenantService) Resolve(ctx context.Context, slug string) (int, error) {
+	s.mu.RLock()
+	id, ok := s.bySlug[slug]
+	s.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+	tenant, err := s.repo.GetBySlug(ctx, slug)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	s.bySlug[slug] = tenant.ID
+	s.mu.Unlock()
+	return tenant.ID, nil
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrInvalidSnapshot возвращается, если токен снимка не удалось разобрать
+var ErrInvalidSnapshot = errors.New("invalid snapshot token")
+
+// ErrInvalidCursor возвращается, если курсор не удалось разобрать или он не сочетается с параметрами запроса
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSort возвращается для сортировки по неизвестному полю или с неизвестным направлением
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ErrInvalidInclude возвращается при запросе неизвестной связанной сущности в include
+var ErrInvalidInclude = errors.New("invalid include")
+
+// sortableColumns поля, по которым разрешена сортировка; имена колонок не берутся из запроса напрямую
+var sortableColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"email": "email",
+	"age":   "age",
+}
+
+// ListParams структура для хранения параметров запроса списка пользователей
+type ListParams struct {
+	Page  int
+	Limit int
+	Name  string
+	// NameLike поиск по части имени без учёта регистра
+	NameLike string
+	Age      *int
+	AgeGte   *int
+	AgeLte   *int
+	Verified *bool
+	// Sort элементы вида field или field:asc|desc в порядке приоритета
+	Sort []string
+	// IncludeDeleted включает мягко удалённых пользователей
+	IncludeDeleted bool
+	// Snapshot "true" фиксирует новый снимок, иначе — токен ранее выданного снимка
+	Snapshot string
+}
+
+// ListResult структура для хранения страницы пользователей
+type ListResult struct {
+	Users []model.User
+	// Total число пользователей, подходящих под фильтр, без учёта пагинации
+	Total int
+	// SnapshotToken токен снимка для следующих страниц, пустой без режима снимка
+	SnapshotToken string
+}
+
+// CursorResult структура для хранения страницы keyset-пагинации
+type CursorResult struct {
+	Users []model.User
+	// NextCursor курсор следующей страницы, пустой на последней странице
+	NextCursor string
+}
+
+// DefaultMaxSortFields число полей сортировки по умолчанию, если UserOptions.MaxSortFields не задан
+const DefaultMaxSortFields = 3
+
+// UserOptions структура для хранения ограничений сервиса пользователей
+type UserOptions struct {
+	// MaxSortFields наибольшее число полей в sort; каждое поле — ещё один ключ ORDER BY, 0 — DefaultMaxSortFields
+	MaxSortFields int
+}
+
+// UserService структура сервиса управления пользователями
+type UserService struct {
+	repo          repository.UserRepository
+	audits        repository.AuditRepository
+	validate      *validator.Validate
+	maxSortFields int
+}
+
+// NewUserService функция для создания сервиса пользователей
+func NewUserService(repo repository.UserRepository, audits repository.AuditRepository, validate *validator.Validate, opts UserOptions) *UserService {
+	if opts.MaxSortFields <= 0 {
+		opts.MaxSortFields = DefaultMaxSortFields
+	}
+	return &UserService{repo: repo, audits: audits, validate: validate, maxSortFields: opts.MaxSortFields}
+}
+
+// List функция для получения страницы пользователей с фильтрацией
+func (s *UserService) List(ctx context.Context, p ListParams) (*ListResult, error) {
+	filter, err := s.listFilter(p)
+	if err != nil {
+		return nil, err
+	}
+	filter.Offset = (p.Page - 1) * p.Limit
+	filter.Limit = p.Limit
+
+	result := &ListResult{}
+	if p.Snapshot != "" {
+		var maxID int
+		if p.Snapshot == "true" {
+			maxID, err = s.repo.MaxID(ctx)
+			if err != nil {
+				return nil, err
+			}
+		} else if maxID, err = decodeSnapshot(p.Snapshot); err != nil {
+			return nil, ErrInvalidSnapshot
+		}
+		filter.MaxID = &maxID
+		result.SnapshotToken = encodeSnapshot(maxID)
+	}
+
+	users, total, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	result.Users = users
+	result.Total = total
+	return result, nil
+}
+
+// maxCursorLimit наибольший размер страницы keyset-пагинации, как у GET /users; меньший 1 считается 1
+const maxCursorLimit = 100
+
+// ListCursor функция для получения страницы пользователей keyset-пагинацией по id: страница начинается сразу
+// после строки из курсора, поэтому её стоимость не растёт с номером страницы, а вставки и удаления не сдвигают
+// следующие страницы. Пустой курсор — первая страница; сортировка допускается только по id, Page не учитывается
+func (s *UserService) ListCursor(ctx context.Context, p ListParams, cursor string) (*CursorResult, error) {
+	if p.Snapshot != "" {
+		return nil, fmt.Errorf("%w: snapshot cannot be combined with cursor, cursor pages are already stable", ErrInvalidCursor)
+	}
+	filter, err := s.listFilter(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.Sort) > 1 || (len(filter.Sort) == 1 && filter.Sort[0].Column != "id") {
+		return nil, fmt.Errorf("%w: cursor pagination is ordered by id, sort must be id:asc or id:desc", ErrInvalidSort)
+	}
+	desc := len(filter.Sort) == 1 && filter.Sort[0].Desc
+	if cursor != "" {
+		afterID, cursorDesc, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		// Курсор действителен только для того направления, в котором он выдан
+		if cursorDesc != desc {
+			return nil, fmt.Errorf("%w: cursor was issued for the opposite sort direction", ErrInvalidCursor)
+		}
+		filter.AfterID = &afterID
+	}
+	limit := min(max(p.Limit, 1), maxCursorLimit)
+	// Лишняя строка показывает, есть ли следующая страница, без подсчёта общего числа
+	filter.Limit = limit + 1
+
+	users, err := s.repo.ListAfter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := &CursorResult{Users: users}
+	if len(users) > limit {
+		result.Users = users[:limit]
+		result.NextCursor = encodeCursor(result.Users[limit-1].ID, desc)
+	}
+	return result, nil
+}
+
+// exportBatchSize число строк, которое выгрузка читает из базы за один раз
+const exportBatchSize = 500
+
+// Export функция для выгрузки всех пользователей, подходящих под фильтры списка, порциями; пагинация и снимок не учитываются
+func (s *UserService) Export(ctx context.Context, p ListParams, fn func([]model.User) error) error {
+	filter, err := s.listFilter(p)
+	if err != nil {
+		return err
+	}
+	return s.repo.Each(ctx, filter, exportBatchSize, fn)
+}
+
+// listFilter функция для перевода параметров списка в фильтр хранилища без пагинации
+func (s *UserService) listFilter(p ListParams) (repository.UserFilter, error) {
+	order, err := parseSort(p.Sort, s.maxSortFields)
+	if err != nil {
+		return repository.UserFilter{}, err
+	}
+	return repository.UserFilter{
+		Name:           p.Name,
+		NameLike:       p.NameLike,
+		Age:            p.Age,
+		AgeGte:         p.AgeGte,
+		AgeLte:         p.AgeLte,
+		Verified:       p.Verified,
+		Sort:           order,
+		IncludeDeleted: p.IncludeDeleted,
+	}, nil
+}
+
+// parseSort функция для разбора и проверки полей сортировки по белому списку; полей не больше maxFields
+func parseSort(items []string, maxFields int) ([]repository.SortField, error) {
+	if len(items) > maxFields {
+		return nil, fmt.Errorf("%w: at most %d sort fields are allowed, got %d", ErrInvalidSort, maxFields, len(items))
+	}
+	fields := make([]repository.SortField, 0, len(items))
+	for _, item := range items {
+		name, dir, _ := strings.Cut(item, ":")
+		column, ok := sortableColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, name)
+		}
+		field := repository.SortField{Column: column}
+		switch strings.ToLower(dir) {
+		case "", "asc":
+		case "desc":
+			field.Desc = true
+		default:
+			return nil, fmt.Errorf("%w: direction for %q must be asc or desc", ErrInvalidSort, name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// GetParams структура для хранения параметров получения одного пользователя
+type GetParams struct {
+	// IncludeDeleted находит и мягко удалённого пользователя
+	IncludeDeleted bool
+	// Include связанные сущности, которые нужно загрузить; поддерживается profile
+	Include []string
+}
+
+// Get функция для получения пользователя по ID вместе с запрошенными связанными сущностями
+func (s *UserService) Get(ctx context.Context, id int, p GetParams) (*model.User, error) {
+	opts := repository.GetOptions{IncludeDeleted: p.IncludeDeleted}
+	for _, name := range p.Include {
+		switch name {
+		case "profile":
+			opts.WithProfile = true
+		default:
+			return nil, fmt.Errorf("%w: unknown relation %q", ErrInvalidInclude, name)
+		}
+	}
+	return s.repo.Get(ctx, id, opts)
+}
+
+// Create функция для валидации и сохранения нового пользователя
+func (s *UserService) Create(ctx context.Context, user *model.User) error {
+	if err := s.validate.Struct(user); err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, user)
+}
+
+// ImportRowError структура для хранения ошибки отдельной строки импорта
+type ImportRowError struct {
+	// Row номер строки во входных данных, начиная с 1
+	Row int
+	Err error
+}
+
+// ImportResult структура для хранения итогов импорта
+type ImportResult struct {
+	Created int
+	Failed  int
+	Errors  []ImportRowError
+	// Users сохранённые пользователи с присвоенными ID
+	Users []*model.User
+}
+
+// ErrTooManyRows возвращается, если в импорте больше строк, чем разрешено
+var ErrTooManyRows = errors.New("too many rows in import")
+
+// CheckImportSize функция для проверки числа строк импорта; maxRows 0 — без ограничения
+func CheckImportSize(rows, maxRows int) error {
+	if maxRows > 0 && rows > maxRows {
+		return fmt.Errorf("%w: %d, the limit is %d", ErrTooManyRows, rows, maxRows)
+	}
+	return nil
+}
+
+// Import функция для пакетного создания пользователей. Строки валидируются до обращения к базе;
+// в режиме atomic любая ошибка отменяет весь импорт, иначе сохраняются все корректные строки
+func (s *UserService) Import(ctx context.Context, users []model.User, atomic bool, maxRows int) (*ImportResult, error) {
+	if err := CheckImportSize(len(users), maxRows); err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	valid := make([]*model.User, 0, len(users))
+	rows := make([]int, 0, len(users))
+	for i := range users {
+		if err := s.validate.Struct(users[i]); err != nil {
+			result.Errors = append(result.Errors, ImportRowError{Row: i + 1, Err: err})
+			continue
+		}
+		valid = append(valid, &users[i])
+		rows = append(rows, i+1)
+	}
+
+	if len(valid) > 0 && !(atomic && len(result.Errors) > 0) {
+		rowErrs, err := s.repo.CreateMany(ctx, valid, atomic)
+		if err != nil {
+			return nil, err
+		}
+		failedInDB := false
+		for i, rowErr := range rowErrs {
+			if rowErr != nil {
+				result.Errors = append(result.Errors, ImportRowError{Row: rows[i], Err: rowErr})
+				failedInDB = true
+			}
+		}
+		// В режиме atomic при ошибке транзакция откачена, сохранённых строк нет
+		if !(atomic && failedInDB) {
+			for i, rowErr := range rowErrs {
+				if rowErr == nil {
+					result.Users = append(result.Users, valid[i])
+				}
+			}
+		}
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	result.Created = len(result.Users)
+	result.Failed = len(users) - result.Created
+	return result, nil
+}
+
+// Update функция для валидации и обновления пользователя; version — ожидаемая версия, 0 — без проверки
+func (s *UserService) Update(ctx context.Context, user *model.User, version int) error {
+	if err := s.validate.Struct(user); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, user, version)
+}
+
+// Patch функция для частичного обновления пользователя; валидируются только переданные поля
+func (s *UserService) Patch(ctx context.Context, id int, patch model.UserPatch, version int) (*model.User, error) {
+	if err := s.validate.Struct(patch); err != nil {
+		return nil, err
+	}
+	return s.repo.Patch(ctx, id, patch, version)
+}
+
+// Delete функция для мягкого удаления пользователя
+func (s *UserService) Delete(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Restore функция для восстановления мягко удалённого пользователя
+func (s *UserService) Restore(ctx context.Context, id int) (*model.User, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+// History функция для получения журнала изменений пользователя, в том числе мягко удалённого
+func (s *UserService) History(ctx context.Context, id int) ([]model.AuditLog, error) {
+	// Журнал общий для всех организаций, поэтому сначала проверяется, что пользователь из организации запроса.
+	// Пустой журнал у существующего пользователя возможен для строк, созданных до появления журнала
+	if _, err := s.repo.Get(ctx, id, repository.GetOptions{IncludeDeleted: true}); err != nil {
+		return nil, err
+	}
+	// Изменения профиля записываются под тем же ID и входят в историю пользователя
+	return s.audits.ListByEntity(ctx, id, model.AuditEntityUser, model.AuditEntityProfile)
+}
+
+// encodeSnapshot функция для кодирования токена снимка
+func encodeSnapshot(maxID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(maxID)))
+}
+
+// encodeCursor функция для кодирования курсора: id последней строки страницы и направление сортировки
+func encodeCursor(lastID int, desc bool) string {
+	dir := "asc"
+	if desc {
+		dir = "desc"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(dir + ":" + strconv.Itoa(lastID)))
+}
+
+// decodeCursor функция для декодирования курсора
+func decodeCursor(cursor string) (lastID int, desc bool, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false, err
+	}
+	dir, id, ok := strings.Cut(string(raw), ":")
+	if !ok || (dir != "asc" && dir != "desc") {
+		return 0, false, fmt.Errorf("unknown cursor format")
+	}
+	if lastID, err = strconv.Atoi(id); err != nil {
+		return 0, false, err
+	}
+	return lastID, dir == "desc", nil
+}
+
+// decodeSnapshot функция для декодирования токена снимка
+func decodeSnapshot(token string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(raw))
+}
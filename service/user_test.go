@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"laba8/model"
+	"laba8/repository"
+)
+
+func TestParseSortMultiColumn(t *testing.T) {
+	got, err := parseSort([]string{"age:desc", "name", "id:ASC"}, 3)
+	if err != nil {
+		t.Fatalf("parseSort: %v", err)
+	}
+	want := []repository.SortField{
+		{Column: "age", Desc: true},
+		{Column: "name"},
+		{Column: "id"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseSort = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSortRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+	}{
+		{"too many fields", []string{"id", "name", "email", "age"}},
+		{"repeated field over the limit", []string{"id", "id", "id", "id"}},
+		{"unknown field", []string{"name", "password"}},
+		{"column name injection", []string{"name; DROP TABLE users"}},
+		{"unknown direction", []string{"age:sideways"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSort(tt.items, 3); !errors.Is(err, ErrInvalidSort) {
+				t.Fatalf("parseSort(%q) error = %v, want ErrInvalidSort", tt.items, err)
+			}
+		})
+	}
+}
+
+func TestListRejectsTooManySortFields(t *testing.T) {
+	// Проверка идёт до обращения к хранилищу, поэтому оно не нужно
+	s := NewUserService(nil, nil, NewValidator(), UserOptions{MaxSortFields: 2})
+	p := ListParams{Page: 1, Limit: 10, Sort: []string{"age:desc", "name", "id"}}
+	if _, err := s.List(context.Background(), p); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("List error = %v, want ErrInvalidSort", err)
+	}
+	if _, err := s.ListCursor(context.Background(), p, ""); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("ListCursor error = %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestNewUserServiceDefaultSortLimit(t *testing.T) {
+	s := NewUserService(nil, nil, NewValidator(), UserOptions{})
+	if s.maxSortFields != DefaultMaxSortFields {
+		t.Fatalf("maxSortFields = %d, want %d", s.maxSortFields, DefaultMaxSortFields)
+	}
+}
+
+// fakeUsers хранилище пользователей в памяти для проверок без базы: ListAfter отдаёт столько строк, сколько просят
+type fakeUsers struct {
+	repository.UserRepository
+	filters []repository.UserFilter
+}
+
+func (f *fakeUsers) ListAfter(ctx context.Context, filter repository.UserFilter) ([]model.User, error) {
+	f.filters = append(f.filters, filter)
+	users := make([]model.User, filter.Limit)
+	for i := range users {
+		users[i].ID = i + 1
+	}
+	return users, nil
+}
+
+func TestListCursorClampsLimit(t *testing.T) {
+	tests := []struct {
+		limit, want int
+	}{
+		{limit: 1_000_000, want: maxCursorLimit},
+		{limit: 0, want: 1},
+		{limit: 25, want: 25},
+	}
+	for _, tt := range tests {
+		repo := &fakeUsers{}
+		s := NewUserService(repo, nil, NewValidator(), UserOptions{})
+		result, err := s.ListCursor(context.Background(), ListParams{Limit: tt.limit}, "")
+		if err != nil {
+			t.Fatalf("ListCursor(limit=%d): %v", tt.limit, err)
+		}
+		if got := repo.filters[0].Limit; got != tt.want+1 {
+			t.Errorf("ListCursor(limit=%d) asked for %d rows, want %d", tt.limit, got, tt.want+1)
+		}
+		if len(result.Users) != tt.want || result.NextCursor == "" {
+			t.Errorf("ListCursor(limit=%d) returned %d users, next cursor %q", tt.limit, len(result.Users), result.NextCursor)
+		}
+	}
+}
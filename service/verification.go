@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"laba8/mailer"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrInvalidVerificationToken возвращается для поддельной, просроченной или выданной для прежнего email ссылки
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// verificationPurpose назначение токена подтверждения; токены других назначений не принимаются
+const verificationPurpose = "email_verification"
+
+// verificationClaims структура для хранения данных токена подтверждения email
+type verificationClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	// TenantID организация пользователя: ссылка открывается без токена доступа
+	TenantID int `json:"tenant_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// VerificationService структура сервиса подтверждения email пользователей
+type VerificationService struct {
+	users   repository.UserRepository
+	mail    mailer.Mailer
+	jobs    *JobRunner
+	secret  []byte
+	ttl     time.Duration
+	baseURL string
+}
+
+// NewVerificationService функция для создания сервиса подтверждения email. Ключ подписи выводится из secret,
+// поэтому токен подтверждения нельзя использовать как токен доступа и наоборот.
+// Письма новым пользователям отправляются фоновыми задачами jobs, обработчик регистрируется здесь
+func NewVerificationService(users repository.UserRepository, mail mailer.Mailer, jobs *JobRunner, secret string, ttl time.Duration, baseURL string) *VerificationService {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(verificationPurpose))
+	s := &VerificationService{users: users, mail: mail, jobs: jobs, secret: mac.Sum(nil), ttl: ttl, baseURL: baseURL}
+	jobs.Register(JobVerificationEmail, s.runSendJob)
+	return s
+}
+
+// verificationJob структура входных данных задачи отправки письма подтверждения
+type verificationJob struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// Send функция для отправки письма со ссылкой подтверждения
+func (s *VerificationService) Send(ctx context.Context, user *model.User) error {
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, verificationClaims{
+		Email:    user.Email,
+		Purpose:  verificationPurpose,
+		TenantID: user.TenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+	}).SignedString(s.secret)
+	if err != nil {
+		return err
+	}
+	link := s.baseURL + "/users/verify?token=" + url.QueryEscape(token)
+	return s.mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello, %s!\n\nConfirm your email address by opening this link:\n%s\n\nThe link is valid for %s.\n",
+			user.Name, link, s.ttl),
+	})
+}
+
+// SendAsync функция для отправки письма фоновой задачей, чтобы ответ API не ждал почтовый сервер;
+// при недоступности почты задача повторяется. Ошибка постановки только логируется
+func (s *VerificationService) SendAsync(ctx context.Context, user *model.User) {
+	if _, err := s.jobs.Enqueue(ctx, JobVerificationEmail, verificationJob{UserID: user.ID, Email: user.Email}); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue verification email", "user_id", user.ID, "err", err)
+	}
+}
+
+// runSendJob функция для выполнения задачи отправки письма. Пользователь перечитывается: если за время
+// ожидания его удалили, подтвердили или сменили email, письмо со старой ссылкой не отправляется
+func (s *VerificationService) runSendJob(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var job verificationJob
+	if err := decodeJobPayload(payload, &job); err != nil {
+		return nil, err
+	}
+	user, err := s.users.Get(ctx, job.UserID, repository.GetOptions{})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Verified || !strings.EqualFold(user.Email, job.Email) {
+		return nil, nil
+	}
+	return nil, s.Send(ctx, user)
+}
+
+// Resend функция для повторной отправки письма неподтверждённому пользователю; письмо ставится
+// в очередь задач, как при создании пользователя
+func (s *VerificationService) Resend(ctx context.Context, id int) error {
+	user, err := s.users.Get(ctx, id, repository.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if user.Verified {
+		return fmt.Errorf("user email is already verified: %w", repository.ErrConflict)
+	}
+	s.SendAsync(ctx, user)
+	return nil
+}
+
+// Verify функция для проверки токена из ссылки и подтверждения email
+func (s *VerificationService) Verify(ctx context.Context, token string) (*model.User, error) {
+	claims := &verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != verificationPurpose {
+		return nil, ErrInvalidVerificationToken
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	// Ссылки, выданные до появления организаций, относятся к организации по умолчанию
+	tenantID := claims.TenantID
+	if tenantID == 0 {
+		tenantID = model.DefaultTenantID
+	}
+	user, err := s.users.MarkVerified(repository.WithTenant(ctx, tenantID), id, claims.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	return user, err
+}
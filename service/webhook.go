@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"laba8/events"
+	"laba8/model"
+	"laba8/repository"
+)
+
+// ErrInvalidDeliveryStatus возвращается для неизвестного состояния в фильтре журнала доставок
+var ErrInvalidDeliveryStatus = errors.New("status must be pending, succeeded or failed")
+
+// Заголовки запроса доставки webhook
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Параметры разбора очереди доставок
+const (
+	webhookPollInterval = time.Second
+	webhookBatchSize    = 20
+	// webhookMaxBackoff верхняя граница паузы между повторами
+	webhookMaxBackoff = time.Hour
+)
+
+// WebhookOptions структура для хранения настроек доставки webhook
+type WebhookOptions struct {
+	// Timeout время ожидания ответа подписчика на одну попытку
+	Timeout time.Duration
+	// MaxAttempts сколько попыток делается, прежде чем доставка помечается неудачной
+	MaxAttempts int
+	// BaseBackoff пауза перед первым повтором; каждая следующая вдвое длиннее
+	BaseBackoff time.Duration
+}
+
+// WebhookService структура сервиса webhook: управление подписками и доставка событий с повторами
+type WebhookService struct {
+	repo     repository.WebhookRepository
+	validate *validator.Validate
+	opts     WebhookOptions
+	client   *http.Client
+}
+
+// NewWebhookService функция для создания сервиса webhook
+func NewWebhookService(repo repository.WebhookRepository, validate *validator.Validate, opts WebhookOptions) *WebhookService {
+	return &WebhookService{
+		repo:     repo,
+		validate: validate,
+		opts:     opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// Перенаправление считается ошибкой доставки: подпись не должна уходить на другой адрес
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Create функция для регистрации подписки; без секрета он генерируется и возвращается в ответе один раз
+func (s *WebhookService) Create(ctx context.Context, hook *model.Webhook) error {
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if err := s.validate.Struct(hook); err != nil {
+		return err
+	}
+	secret := hook.Secret
+	if secret == "" {
+		var err error
+		if secret, err = randomToken(32); err != nil {
+			return err
+		}
+		hook.Secret = secret
+	}
+	if err := s.repo.Create(ctx, hook); err != nil {
+		return err
+	}
+	hook.Secret = secret
+	return nil
+}
+
+// Get функция для получения подписки без секрета
+func (s *WebhookService) Get(ctx context.Context, id int) (*model.Webhook, error) {
+	hook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+// List функция для получения всех подписок без секретов
+func (s *WebhookService) List(ctx context.Context) ([]model.Webhook, error) {
+	hooks, err := s.repo.List(ctx)
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, err
+}
+
+// Update функция для замены подписки; передача secret меняет ключ подписи
+func (s *WebhookService) Update(ctx context.Context, hook *model.Webhook) error {
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if err := s.validate.Struct(hook); err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, hook); err != nil {
+		return err
+	}
+	hook.Secret = ""
+	return nil
+}
+
+// Delete функция для удаления подписки
+func (s *WebhookService) Delete(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Deliveries функция для получения журнала доставок подписки
+func (s *WebhookService) Deliveries(ctx context.Context, webhookID int, status string, limit int) ([]model.WebhookDelivery, error) {
+	switch status {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryFailed:
+	default:
+		return nil, ErrInvalidDeliveryStatus
+	}
+	return s.repo.Deliveries(ctx, webhookID, status, limit)
+}
+
+// Run функция для разбора очереди доставок с повторами до отмены ctx. Очередь в базе переживает
+// перезапуск сервиса, а пополняет её диспетчер outbox через Enqueue
+func (s *WebhookService) Run(ctx context.Context) {
+	s.deliverLoop(ctx)
+}
+
+// Enqueue функция для постановки события в очередь доставок всем подходящим подпискам организации события
+func (s *WebhookService) Enqueue(ctx context.Context, e events.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.Enqueue(repository.WithTenant(ctx, e.TenantID), e.Type, payload)
+	return err
+}
+
+// deliverLoop функция для периодического разбора очереди доставок
+func (s *WebhookService) deliverLoop(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Пока доставка в работе, другие обработчики её не берут; запас на случай медленного подписчика
+		deliveries, err := s.repo.ClaimDue(ctx, webhookBatchSize, 2*s.opts.Timeout+time.Minute)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to read webhook delivery queue", "err", err)
+			}
+			continue
+		}
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(d *model.WebhookDelivery) {
+				defer wg.Done()
+				s.deliver(ctx, d)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+	}
+}
+
+// deliver функция для одной попытки доставки и записи её результата
+func (s *WebhookService) deliver(ctx context.Context, d *model.WebhookDelivery) {
+	if d.Webhook == nil || d.Webhook.Disabled {
+		d.Status = model.DeliveryFailed
+		d.LastError = "webhook is disabled"
+	} else {
+		code, err := s.send(ctx, d)
+		if err != nil && ctx.Err() != nil {
+			// Попытку прервала остановка сервиса: она не засчитывается, доставка вернётся в очередь после lease
+			return
+		}
+		d.Attempts++
+		d.ResponseCode = code
+		switch {
+		case err == nil:
+			now := time.Now()
+			d.Status = model.DeliverySucceeded
+			d.LastError = ""
+			d.DeliveredAt = &now
+		case d.Attempts >= s.opts.MaxAttempts:
+			d.Status = model.DeliveryFailed
+			d.LastError = err.Error()
+		default:
+			d.LastError = err.Error()
+			d.NextAttemptAt = time.Now().Add(s.backoff(d.Attempts))
+		}
+	}
+	// Результат сохраняется и во время остановки сервиса, иначе успешная доставка ушла бы повторно
+	if err := s.repo.RecordAttempt(context.WithoutCancel(ctx), d); err != nil {
+		slog.ErrorContext(ctx, "Failed to record webhook delivery", "delivery_id", d.ID, "err", err)
+	}
+}
+
+// send функция для отправки доставки подписчику; возвращает код ответа, 0 — ответа не было
+func (s *WebhookService) send(ctx context.Context, d *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Webhook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "laba8-webhooks")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(d.Webhook.Secret, time.Now(), d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff функция для расчёта паузы перед следующей попыткой доставки
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	return retryBackoff(s.opts.BaseBackoff, webhookMaxBackoff, attempts)
+}
+
+// retryBackoff функция для расчёта паузы перед повтором: экспонента от base, не больше limit,
+// с разбросом до 20%, чтобы повторы не шли пачкой
+func retryBackoff(base, limit time.Duration, attempts int) time.Duration {
+	d := base << (attempts - 1)
+	if d <= 0 || d > limit {
+		d = limit
+	}
+	return d + time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+// SignWebhook функция для построения заголовка подписи: t=<unix-время>,v1=<hex HMAC-SHA256 от "t.тело">.
+// Получатель пересчитывает HMAC своим секретом и отклоняет запросы со старым t, чтобы их нельзя было повторить
+func SignWebhook(secret string, at time.Time, payload []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,142 @@
+// Package storage содержит хранилище файлов (аватары): локальный диск, с интерфейсом для S3-совместимых бэкендов.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotExist возвращается, когда объекта с таким ключом нет
+var ErrNotExist = errors.New("object does not exist")
+
+// Info структура для хранения сведений об объекте
+type Info struct {
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+	// ETag меняется при каждой перезаписи объекта
+	ETag string
+}
+
+// Object структура для чтения сохранённого объекта; Body нужно закрыть.
+// Локальное хранилище отдаёт Body с io.Seeker, чтобы поддерживались Range-запросы
+type Object struct {
+	Body io.ReadCloser
+	Info Info
+}
+
+// Storage интерфейс хранилища объектов по строковым ключам вида avatars/1/original
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Local реализация Storage в каталоге на диске; тип содержимого хранится в соседнем файле .type
+type Local struct {
+	dir string
+}
+
+// NewLocal функция для создания хранилища в каталоге dir; каталог создаётся при необходимости
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// path функция для перевода ключа в путь внутри каталога хранилища
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.dir, clean), nil
+}
+
+// Put функция для сохранения объекта; запись идёт во временный файл и переименовывается,
+// поэтому читатели не видят частично записанный объект
+func (l *Local) Put(_ context.Context, key string, body io.Reader, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".type", []byte(contentType), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get функция для открытия объекта на чтение
+func (l *Local) Get(_ context.Context, key string) (*Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	contentType, err := os.ReadFile(path + ".type")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		f.Close()
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(key + "|" + strconv.FormatInt(st.Size(), 10) + "|" + st.ModTime().UTC().Format(time.RFC3339Nano)))
+	return &Object{
+		Body: f,
+		Info: Info{
+			Size:         st.Size(),
+			ContentType:  string(contentType),
+			LastModified: st.ModTime(),
+			ETag:         `"` + hex.EncodeToString(sum[:8]) + `"`,
+		},
+	}, nil
+}
+
+// Delete функция для удаления объекта; отсутствующий объект ошибкой не считается
+func (l *Local) Delete(_ context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, path + ".type"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}